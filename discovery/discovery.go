@@ -0,0 +1,290 @@
+// Package discovery resolves the addresses of the services a service calls.
+//
+// The addresses of a service are taken from the first of
+//
+//   - the -endpoint flag (see RegisterFlags) or WithEndpoint,
+//   - the environment variable named after the service, SERVICE_B_ADDR for
+//     service-b,
+//   - the registry file named by -registry or SERVICE_REGISTRY_FILE, a JSON
+//     object mapping service names to lists of addresses,
+//   - the default given by the caller,
+//
+// that has an entry for it. Flags, environment variables and defaults are
+// comma-separated lists. An address is a host:port, or srv:NAME for the
+// targets of the DNS SRV records of NAME, e.g. srv:_grpc._tcp.service-b.
+// Calls are balanced round-robin over all the addresses, which are looked up
+// again periodically, so that replicas can come and go.
+//
+// For gRPC, a single value containing "://", such as dns:///service-b:50051
+// or xds:///service-b, is handed to gRPC unchanged, so that any resolver
+// registered with gRPC can be used instead.
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+const defaultRefreshInterval = 30 * time.Second
+
+// Registry resolves service names to addresses.
+type Registry struct {
+	cfg        config
+	lookupSRV  func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	mu    sync.Mutex // guards the registry file
+	file  map[string][]string
+	stamp fileStamp
+}
+
+// fileStamp tells a version of the registry file from the next: a rewrite
+// within the mtime resolution of the file system changes the size only.
+type fileStamp struct {
+	modTime int64
+	size    int64
+}
+
+func stampOf(fi os.FileInfo) fileStamp {
+	return fileStamp{modTime: fi.ModTime().UnixNano(), size: fi.Size()}
+}
+
+// New returns a Registry. It fails if the registry file cannot be read.
+func New(opts ...Option) (*Registry, error) {
+	cfg := config{
+		endpoints:       map[string]string{},
+		registryFile:    strings.TrimSpace(os.Getenv("SERVICE_REGISTRY_FILE")),
+		refreshInterval: defaultRefreshInterval,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	r := &Registry{
+		cfg:        cfg,
+		lookupSRV:  net.DefaultResolver.LookupSRV,
+		lookupHost: net.DefaultResolver.LookupHost,
+	}
+	if cfg.registryFile != "" {
+		if err := r.loadFile(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// EnvName returns the environment variable holding the addresses of the
+// service called name: SERVICE_B_ADDR for service-b.
+func EnvName(name string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name)) + "_ADDR"
+}
+
+// Endpoint returns the endpoint of the service called name, with fallback
+// as its addresses when nothing else is configured. It fails if the
+// configured addresses are malformed.
+func (r *Registry) Endpoint(name, fallback string) (*Endpoint, error) {
+	e := &Endpoint{r: r, name: name, fallback: fallback}
+	entries := r.configured(name, fallback)
+	if len(entries) == 1 && strings.Contains(entries[0], "://") {
+		e.target = entries[0]
+		return e, nil
+	}
+	if err := validate(entries); err != nil {
+		return nil, fmt.Errorf("invalid address for %s: %w", name, err)
+	}
+	return e, nil
+}
+
+// configured returns the addresses of name from the first source that has
+// them.
+func (r *Registry) configured(name, fallback string) []string {
+	if v, ok := r.cfg.endpoints[name]; ok {
+		return splitList(v)
+	}
+	if v := strings.TrimSpace(os.Getenv(EnvName(name))); v != "" {
+		return splitList(v)
+	}
+	if r.cfg.registryFile != "" {
+		if err := r.loadFile(); err != nil {
+			// Keep the last version that could be read.
+			otel.Handle(err)
+		}
+		r.mu.Lock()
+		addrs, ok := r.file[name]
+		r.mu.Unlock()
+		if ok {
+			return addrs
+		}
+	}
+	return splitList(fallback)
+}
+
+// loadFile reads the registry file when its modification time or size
+// changed.
+func (r *Registry) loadFile() error {
+	fi, err := os.Stat(r.cfg.registryFile)
+	if err != nil {
+		return fmt.Errorf("failed to read registry file: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stampOf(fi) == r.stamp {
+		return nil
+	}
+	data, err := os.ReadFile(r.cfg.registryFile)
+	if err != nil {
+		return fmt.Errorf("failed to read registry file: %w", err)
+	}
+	// Remember the version even if it is broken, so that it is reported
+	// once rather than on every lookup.
+	r.stamp = stampOf(fi)
+
+	var file map[string][]string
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid registry file %s: %w", r.cfg.registryFile, err)
+	}
+	for name, addrs := range file {
+		if err := validate(addrs); err != nil {
+			return fmt.Errorf("invalid registry file %s: %s: %w", r.cfg.registryFile, name, err)
+		}
+	}
+	r.file = file
+	return nil
+}
+
+// Endpoint is a service that may have several addresses.
+type Endpoint struct {
+	r              *Registry
+	name, fallback string
+	target         string // a gRPC target to use as is
+
+	next       atomic.Uint64
+	mu         sync.Mutex
+	addrs      []string
+	resolvedAt time.Time
+	resolving  bool // a lookup is in flight
+}
+
+// Name returns the name of the service.
+func (e *Endpoint) Name() string {
+	return e.name
+}
+
+// Resolve returns the current addresses of the service, with SRV records
+// looked up.
+func (e *Endpoint) Resolve(ctx context.Context) ([]string, error) {
+	if e.target != "" {
+		return nil, fmt.Errorf("%s is configured as the gRPC target %s, not as addresses", e.name, e.target)
+	}
+	entries := e.r.configured(e.name, e.fallback)
+	if err := validate(entries); err != nil {
+		return nil, fmt.Errorf("invalid address for %s: %w", e.name, err)
+	}
+
+	var addrs []string
+	var errs []error
+	seen := make(map[string]bool)
+	add := func(addr string) {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(entry, "srv:")
+		if !ok {
+			add(entry)
+			continue
+		}
+		_, srvs, err := e.r.lookupSRV(ctx, "", "", name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to look up SRV records of %s: %w", name, err))
+			continue
+		}
+		for _, srv := range srvs {
+			add(net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+		}
+	}
+	if len(addrs) == 0 {
+		if len(errs) == 0 {
+			errs = append(errs, errors.New("no addresses"))
+		}
+		return nil, fmt.Errorf("failed to resolve %s: %w", e.name, errors.Join(errs...))
+	}
+	if len(errs) > 0 {
+		otel.Handle(fmt.Errorf("failed to resolve some addresses of %s: %w", e.name, errors.Join(errs...)))
+	}
+	return addrs, nil
+}
+
+// Addr returns the address to send the next request to, going round-robin
+// over the addresses of the service. They are looked up again once they are
+// older than the refresh interval; if that fails, the previous ones are kept.
+// The lookup runs without holding the lock: while it does, other requests
+// keep using the previous addresses.
+func (e *Endpoint) Addr(ctx context.Context) (string, error) {
+	e.mu.Lock()
+	addrs := e.addrs
+	refresh := time.Since(e.resolvedAt) >= e.r.cfg.refreshInterval && (!e.resolving || len(addrs) == 0)
+	if refresh {
+		e.resolving = true
+	}
+	e.mu.Unlock()
+
+	if refresh {
+		resolved, err := e.Resolve(ctx)
+		e.mu.Lock()
+		e.resolving = false
+		switch {
+		case err == nil:
+			e.addrs, e.resolvedAt = resolved, time.Now()
+		case len(e.addrs) > 0:
+			otel.Handle(err)
+			e.resolvedAt = time.Now()
+		default:
+			e.mu.Unlock()
+			return "", err
+		}
+		addrs = e.addrs
+		e.mu.Unlock()
+	}
+	return addrs[(e.next.Add(1)-1)%uint64(len(addrs))], nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func validate(entries []string) error {
+	if len(entries) == 0 {
+		return errors.New("no addresses")
+	}
+	for _, entry := range entries {
+		if name, ok := strings.CutPrefix(entry, "srv:"); ok {
+			if name == "" {
+				return fmt.Errorf("%q: missing SRV name", entry)
+			}
+			continue
+		}
+		if _, port, err := net.SplitHostPort(entry); err != nil || port == "" {
+			return fmt.Errorf("%q: want host:port or srv:name", entry)
+		}
+	}
+	return nil
+}
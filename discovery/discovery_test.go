@@ -0,0 +1,98 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestRegistryFileSameModTime rewrites the registry file without changing
+// its mtime, as on a file system with a resolution of a second.
+func TestRegistryFileSameModTime(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "registry.json")
+	mtime := time.Now().Truncate(time.Second)
+	write := func(body string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"service-d":["d1:8089"]}`)
+	r, err := New(WithRegistryFile(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.configured("service-d", ""); !reflect.DeepEqual(got, []string{"d1:8089"}) {
+		t.Fatalf("service-d = %v, want [d1:8089]", got)
+	}
+	write(`{"service-d":["d1:8089","d2:8089"]}`)
+	if got := r.configured("service-d", ""); !reflect.DeepEqual(got, []string{"d1:8089", "d2:8089"}) {
+		t.Errorf("service-d = %v after the rewrite, want [d1:8089 d2:8089]", got)
+	}
+}
+
+// TestAddrDuringLookup checks that a slow SRV lookup does not hold up the
+// requests using the addresses resolved before.
+func TestAddrDuringLookup(t *testing.T) {
+	r, err := New(WithEndpoint("service-d", "srv:_http._tcp.service-d"), WithRefreshInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srvs := []*net.SRV{{Target: "d1.", Port: 8089}}
+	lookups := make(chan struct{}, 1)
+	release := make(chan struct{})
+	r.lookupSRV = func(ctx context.Context, _, _, _ string) (string, []*net.SRV, error) {
+		select {
+		case lookups <- struct{}{}:
+			<-release
+		default:
+		}
+		return "", srvs, nil
+	}
+	e, err := r.Endpoint("service-d", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first lookup has nothing to fall back on.
+	first := make(chan string)
+	go func() {
+		addr, _ := e.Addr(context.Background())
+		first <- addr
+	}()
+	<-lookups
+	close(release)
+	if addr := <-first; addr != "d1:8089" {
+		t.Fatalf("Addr() = %q, want d1:8089", addr)
+	}
+
+	// A refresh blocked in the lookup leaves the others on the previous
+	// addresses.
+	release = make(chan struct{})
+	defer close(release)
+	time.Sleep(2 * time.Millisecond)
+	go e.Addr(context.Background())
+	<-lookups
+
+	done := make(chan string)
+	go func() {
+		addr, _ := e.Addr(context.Background())
+		done <- addr
+	}()
+	select {
+	case addr := <-done:
+		if addr != "d1:8089" {
+			t.Errorf("Addr() = %q, want d1:8089", addr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Addr() blocked on a lookup in flight")
+	}
+}
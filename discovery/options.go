@@ -0,0 +1,89 @@
+package discovery
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type config struct {
+	endpoints       map[string]string
+	registryFile    string
+	refreshInterval time.Duration
+}
+
+// Option configures a Registry.
+type Option func(*config)
+
+// WithEndpoint sets the addresses of the service called name, a
+// comma-separated list, ahead of the environment and the registry file.
+func WithEndpoint(name, addrs string) Option {
+	return func(c *config) {
+		c.endpoints[name] = addrs
+	}
+}
+
+// WithRegistryFile sets the registry file, overriding
+// SERVICE_REGISTRY_FILE.
+func WithRegistryFile(path string) Option {
+	return func(c *config) {
+		if path != "" {
+			c.registryFile = path
+		}
+	}
+}
+
+// WithRefreshInterval sets how often SRV records and the registry file are
+// looked up again, 30 seconds by default.
+func WithRefreshInterval(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.refreshInterval = d
+		}
+	}
+}
+
+// RegisterFlags defines the flags
+//
+//	-endpoint service=address[,address...]  repeatable
+//	-registry file
+//
+// on fs and returns an Option applying them, to pass to New once fs has
+// been parsed.
+func RegisterFlags(fs *flag.FlagSet) Option {
+	endpoints := endpointFlag{}
+	fs.Var(endpoints, "endpoint", "`service=address[,address...]` of a downstream service; repeatable")
+	registryFile := fs.String("registry", "", "JSON `file` mapping service names to addresses (default $SERVICE_REGISTRY_FILE)")
+	return func(c *config) {
+		for name, addrs := range endpoints {
+			c.endpoints[name] = addrs
+		}
+		WithRegistryFile(*registryFile)(c)
+	}
+}
+
+type endpointFlag map[string]string
+
+func (f endpointFlag) String() string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + f[name]
+	}
+	return strings.Join(names, " ")
+}
+
+func (f endpointFlag) Set(v string) error {
+	name, addrs, ok := strings.Cut(v, "=")
+	name, addrs = strings.TrimSpace(name), strings.TrimSpace(addrs)
+	if !ok || name == "" || addrs == "" {
+		return fmt.Errorf("want service=address, got %q", v)
+	}
+	f[name] = addrs
+	return nil
+}
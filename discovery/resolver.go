@@ -0,0 +1,145 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the gRPC resolver scheme of the targets returned by Target.
+const Scheme = "discovery"
+
+// minResolveInterval bounds how often gRPC can make the resolver look up the
+// addresses again after connection failures.
+const minResolveInterval = time.Second
+
+// Target returns the gRPC target to dial the service with, together with
+// DialOptions.
+func (e *Endpoint) Target() string {
+	if e.target != "" {
+		return e.target
+	}
+	return Scheme + ":///" + e.name
+}
+
+// DialOptions returns the options installing the resolver for Target. Host
+// names are resolved to all their IP addresses, so that a round-robin
+// balancer spreads calls over every replica behind a name.
+func (e *Endpoint) DialOptions() []grpc.DialOption {
+	if e.target != "" {
+		return nil
+	}
+	return []grpc.DialOption{grpc.WithResolvers(resolverBuilder{e})}
+}
+
+type resolverBuilder struct {
+	e *Endpoint
+}
+
+func (b resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+func (b resolverBuilder) Build(_ resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &grpcResolver{
+		e:      b.e,
+		cc:     cc,
+		cancel: cancel,
+		now:    make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go r.watch(ctx)
+	return r, nil
+}
+
+// grpcResolver pushes the addresses of an endpoint to a gRPC connection,
+// every refresh interval and whenever gRPC asks for it.
+type grpcResolver struct {
+	e      *Endpoint
+	cc     resolver.ClientConn
+	cancel context.CancelFunc
+	now    chan struct{}
+	done   chan struct{}
+}
+
+func (r *grpcResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+func (r *grpcResolver) Close() {
+	r.cancel()
+	<-r.done
+}
+
+func (r *grpcResolver) watch(ctx context.Context) {
+	defer close(r.done)
+	ticker := time.NewTicker(r.e.r.cfg.refreshInterval)
+	defer ticker.Stop()
+	for {
+		last := time.Now()
+		r.update(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.now:
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(last.Add(minResolveInterval))):
+			}
+		}
+	}
+}
+
+func (r *grpcResolver) update(ctx context.Context) {
+	addrs, err := r.e.Resolve(ctx)
+	if err == nil {
+		addrs, err = r.resolveHosts(ctx, addrs)
+	}
+	if err != nil {
+		r.cc.ReportError(err)
+		return
+	}
+	state := resolver.State{Addresses: make([]resolver.Address, 0, len(addrs))}
+	for _, a := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: a})
+	}
+	// An error means the balancer rejected the addresses; it is reported
+	// on the connection and the next update is tried all the same.
+	_ = r.cc.UpdateState(state)
+}
+
+// resolveHosts replaces host names with their IP addresses. Names that do
+// not resolve are left out, unless none does.
+func (r *grpcResolver) resolveHosts(ctx context.Context, addrs []string) ([]string, error) {
+	var out []string
+	var lastErr error
+	for _, addr := range addrs {
+		host, port, _ := net.SplitHostPort(addr)
+		if net.ParseIP(host) != nil {
+			out = append(out, addr)
+			continue
+		}
+		ips, err := r.e.r.lookupHost(ctx, host)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, ip := range ips {
+			out = append(out, net.JoinHostPort(ip, port))
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("failed to resolve %s: %w", r.e.name, lastErr)
+	}
+	return out, nil
+}
@@ -0,0 +1,33 @@
+package e2e
+
+import (
+	"testing"
+	"time"
+)
+
+// TestBaggageReachesServiceE checks that the baggage service-a's /start
+// sets is read by service-e's todos resolver, four hops and two protocols
+// away.
+func TestBaggageReachesServiceE(t *testing.T) {
+	c := newCollector(t)
+	ch := startChain(t, c, "OTEL_BSP_SCHEDULE_DELAY=100")
+
+	res := ch.start(t)
+
+	var resolver *span
+	found := waitFor(t, 10*time.Second, func() bool {
+		for _, s := range c.Spans() {
+			if s.service == "service-e" && s.traceID == res.TraceID && s.attrs["todos.origin"] != "" {
+				resolver = &s
+				return true
+			}
+		}
+		return false
+	})
+	if !found {
+		t.Fatalf("no service-e span of trace %s records the origin read by the todos resolver", res.TraceID)
+	}
+	if got := resolver.attrs["todos.origin"]; got != "service-a" {
+		t.Errorf("todos resolver read origin %q from baggage, want service-a", got)
+	}
+}
@@ -0,0 +1,92 @@
+package e2e
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// span is the part of an exported span the tests look at.
+type span struct {
+	service string
+	name    string
+	traceID string
+	attrs   map[string]string
+}
+
+// collector stands in for an OpenTelemetry collector receiving OTLP/HTTP
+// protobuf. It keeps the spans and accepts metrics and logs unread.
+type collector struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	spans []span
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.serveHTTP))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *collector) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Path == "/v1/traces" {
+		var req coltracepb.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.add(&req)
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *collector) add(req *coltracepb.ExportTraceServiceRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		service := attributes(rs.GetResource().GetAttributes())["service.name"]
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				c.spans = append(c.spans, span{
+					service: service,
+					name:    s.Name,
+					traceID: hex.EncodeToString(s.TraceId),
+					attrs:   attributes(s.Attributes),
+				})
+			}
+		}
+	}
+}
+
+// Spans returns the spans received so far.
+func (c *collector) Spans() []span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]span(nil), c.spans...)
+}
+
+// attributes flattens the string attributes of kvs.
+func attributes(kvs []*commonpb.KeyValue) map[string]string {
+	m := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		if v, ok := kv.Value.GetValue().(*commonpb.AnyValue_StringValue); ok {
+			m[kv.Key] = v.StringValue
+		}
+	}
+	return m
+}
@@ -0,0 +1,5 @@
+// Package e2e runs the services of this repository as separate processes,
+// wired to each other on localhost, and checks the telemetry they export to
+// an in-process OTLP receiver. The services are built from source by the
+// tests, so they need the go command; go test -short skips them.
+package e2e
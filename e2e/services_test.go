@@ -0,0 +1,259 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// services lists the services in the order they are started: every service
+// is up before the ones calling it.
+var services = []string{"service-e", "service-d", "service-c", "service-b", "service-a"}
+
+var (
+	buildOnce sync.Once
+	binDir    string
+	buildErr  error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if binDir != "" {
+		_ = os.RemoveAll(binDir)
+	}
+	os.Exit(code)
+}
+
+// buildServices builds every service once per test binary and returns the
+// directory holding them.
+func buildServices(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping: builds and runs every service")
+	}
+	buildOnce.Do(func() {
+		binDir, buildErr = os.MkdirTemp("", "e2e-services")
+		if buildErr != nil {
+			return
+		}
+		for _, name := range services {
+			cmd := exec.Command("go", "build", "-o", filepath.Join(binDir, name), ".")
+			cmd.Dir = filepath.Join("..", name)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				buildErr = fmt.Errorf("failed to build %s: %v\n%s", name, err, out)
+				return
+			}
+		}
+	})
+	if buildErr != nil {
+		t.Fatal(buildErr)
+	}
+	return binDir
+}
+
+// process is a running service.
+type process struct {
+	name string
+	cmd  *exec.Cmd
+	out  syncBuffer
+	done chan struct{}
+	err  error
+}
+
+// terminate sends SIGTERM and waits for the service to exit.
+func (p *process) terminate() error {
+	if err := p.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return fmt.Errorf("failed to signal %s: %w", p.name, err)
+	}
+	select {
+	case <-p.done:
+		return p.err
+	case <-time.After(30 * time.Second):
+		_ = p.cmd.Process.Kill()
+		return fmt.Errorf("%s did not exit after SIGTERM", p.name)
+	}
+}
+
+// chain is the five services, calling each other on localhost and exporting
+// their spans to a collector.
+type chain struct {
+	url   string
+	procs map[string]*process
+}
+
+// startChain starts every service with env added to its environment and
+// waits until they listen.
+func startChain(t *testing.T, c *collector, env ...string) *chain {
+	t.Helper()
+	bin := buildServices(t)
+
+	addrs := make(map[string]string, len(services))
+	for _, name := range services {
+		addrs[name] = freeAddr(t)
+	}
+	common := append(cleanEnv(),
+		"OTEL_EXPORTER_OTLP_ENDPOINT="+c.URL,
+		"OTEL_EXPORTER_OTLP_PROTOCOL=http/protobuf",
+		"OTEL_METRICS_EXPORTER=none",
+		"OTEL_LOGS_EXPORTER=console",
+		"SHUTDOWN_TIMEOUT=10s",
+		"SERVICE_B_ADDR="+addrs["service-b"],
+		"SERVICE_C_ADDR="+addrs["service-c"],
+		"SERVICE_D_ADDR="+addrs["service-d"],
+		"SERVICE_E_ADDR="+addrs["service-e"],
+	)
+	common = append(common, env...)
+
+	ch := &chain{url: "http://" + addrs["service-a"] + "/start", procs: map[string]*process{}}
+	for _, name := range services {
+		p := &process{name: name, done: make(chan struct{})}
+		p.cmd = exec.Command(filepath.Join(bin, name), "-addr", addrs[name])
+		p.cmd.Env = append(slices.Clip(common), "ADMIN_ADDR="+freeAddr(t))
+		p.cmd.Stdout = &p.out
+		p.cmd.Stderr = &p.out
+		if err := p.cmd.Start(); err != nil {
+			t.Fatalf("failed to start %s: %v", name, err)
+		}
+		go func() {
+			p.err = p.cmd.Wait()
+			close(p.done)
+		}()
+		ch.procs[name] = p
+		t.Cleanup(func() {
+			_ = p.cmd.Process.Kill()
+			<-p.done
+			if t.Failed() {
+				t.Logf("%s output:\n%s", name, p.out.String())
+			}
+		})
+		waitListening(t, p, addrs[name])
+	}
+	return ch
+}
+
+// startResponse is the part of the /start response the tests look at.
+type startResponse struct {
+	TraceID string `json:"trace_id"`
+	Calls   []struct {
+		Result string `json:"result"`
+	} `json:"calls"`
+}
+
+// start calls /start, retrying while the gRPC connections come up, and
+// returns the response.
+func (ch *chain) start(t *testing.T) startResponse {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		res, err := http.Get(ch.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body bytes.Buffer
+		_, _ = body.ReadFrom(res.Body)
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			var sr startResponse
+			if err := json.Unmarshal(body.Bytes(), &sr); err != nil {
+				t.Fatalf("invalid /start response %q: %v", body.String(), err)
+			}
+			return sr
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("/start returned %s: %s", res.Status, body.String())
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// cleanEnv returns the environment of the test without the variables
+// configuring the services, so that the tests set them all.
+func cleanEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		switch {
+		case strings.HasPrefix(key, "OTEL_"), strings.HasPrefix(key, "SERVICE_"),
+			strings.HasPrefix(key, "CONTAINER_"), strings.HasPrefix(key, "TELEMETRY_"),
+			key == "ADMIN_ADDR", key == "ADMIN_TOKEN", key == "LOG_LEVEL",
+			key == "SHUTDOWN_TIMEOUT", key == "PORT":
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// freeAddr returns a localhost address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+func waitListening(t *testing.T, p *process, addr string) {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		select {
+		case <-p.done:
+			t.Fatalf("%s exited: %v\n%s", p.name, p.err, p.out.String())
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s is not listening on %s", p.name, addr)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// waitFor polls cond until it holds or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+// syncBuffer collects the output of a process.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,97 @@
+package e2e
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestSIGTERMFlushesSpans checks that services stopped with SIGTERM, as
+// docker compose does, export every span still buffered in their batch
+// processors.
+func TestSIGTERMFlushesSpans(t *testing.T) {
+	c := newCollector(t)
+	// Keep every span in the batch processors until shutdown.
+	ch := startChain(t, c, "OTEL_BSP_SCHEDULE_DELAY=600000")
+
+	const requests = 5
+	traces := make([]string, requests)
+	for i := range traces {
+		traces[i] = ch.start(t).TraceID
+	}
+	if n := len(c.Spans()); n != 0 {
+		t.Fatalf("%d spans exported before shutdown, want them all still buffered", n)
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range ch.procs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.terminate(); err != nil {
+				t.Errorf("%s: %v", p.name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	spans := c.Spans()
+	received := map[string]int{}
+	seen := map[string]map[string]bool{}
+	for _, s := range spans {
+		received[s.service]++
+		if seen[s.traceID] == nil {
+			seen[s.traceID] = map[string]bool{}
+		}
+		seen[s.traceID][s.service] = true
+	}
+
+	for _, name := range services {
+		flushed := flushedSpans(t, ch.procs[name].out.String())
+		if flushed.Failed != 0 || flushed.Dropped != 0 {
+			t.Errorf("%s: %d spans failed and %d dropped on shutdown", name, flushed.Failed, flushed.Dropped)
+		}
+		if flushed.Exported != received[name] {
+			t.Errorf("%s logged %d spans exported, the collector received %d", name, flushed.Exported, received[name])
+		}
+		for _, id := range traces {
+			if !seen[id][name] {
+				t.Errorf("trace %s has no span from %s", id, name)
+			}
+		}
+	}
+}
+
+type flushed struct {
+	Exported int `json:"exported"`
+	Failed   int `json:"failed"`
+	Dropped  int `json:"dropped"`
+}
+
+// flushedSpans adds up the "flushed spans" log lines a service writes on
+// shutdown, one per exporter.
+func flushedSpans(t *testing.T, output string) flushed {
+	t.Helper()
+	var total flushed
+	var found bool
+	sc := bufio.NewScanner(strings.NewReader(output))
+	for sc.Scan() {
+		var line struct {
+			Msg string `json:"msg"`
+			flushed
+		}
+		if json.Unmarshal(sc.Bytes(), &line) != nil || line.Msg != "flushed spans" {
+			continue
+		}
+		found = true
+		total.Exported += line.Exported
+		total.Failed += line.Failed
+		total.Dropped += line.Dropped
+	}
+	if !found {
+		t.Errorf("no flushed spans log line in:\n%s", output)
+	}
+	return total
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// payload is a JSON body for POST /start, sent with a relative weight.
+type payload struct {
+	weight int
+	body   []byte
+}
+
+// payloadFlag collects the repeatable -payload flag, "[weight:]json".
+type payloadFlag []payload
+
+func (f *payloadFlag) String() string {
+	parts := make([]string, len(*f))
+	for i, p := range *f {
+		parts[i] = strconv.Itoa(p.weight) + ":" + string(p.body)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f *payloadFlag) Set(v string) error {
+	p := payload{weight: 1, body: []byte(strings.TrimSpace(v))}
+	if w, body, ok := strings.Cut(v, ":"); ok && !strings.HasPrefix(strings.TrimSpace(w), "{") {
+		n, err := strconv.Atoi(strings.TrimSpace(w))
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid weight %q: want a positive integer", w)
+		}
+		p = payload{weight: n, body: []byte(strings.TrimSpace(body))}
+	}
+	if !json.Valid(p.body) {
+		return fmt.Errorf("invalid JSON body %q", p.body)
+	}
+	*f = append(*f, p)
+	return nil
+}
+
+// generator sends requests to url and records their outcome.
+type generator struct {
+	client      *http.Client
+	url         string
+	payloads    []payload
+	totalWeight int
+	rate        float64
+	concurrency int
+
+	mu      sync.Mutex
+	results []payloadStats
+	skipped int
+}
+
+// payloadStats is the outcome of the requests sent with one payload.
+type payloadStats struct {
+	latencies []time.Duration
+	failed    int
+	errors    map[string]int
+}
+
+func newGenerator(client *http.Client, url string, payloads []payload, rate float64, concurrency int) *generator {
+	g := &generator{
+		client:      client,
+		url:         url,
+		payloads:    payloads,
+		rate:        rate,
+		concurrency: concurrency,
+		results:     make([]payloadStats, len(payloads)),
+	}
+	for i, p := range payloads {
+		g.totalWeight += p.weight
+		g.results[i].errors = map[string]int{}
+	}
+	return g
+}
+
+// runOpen sends requests at the configured rate until run is done, whatever
+// their latency. A request due while concurrency requests are in flight is
+// skipped rather than delayed, and latencies are measured from the time a
+// request was due, so that a slow server cannot slow the load down.
+func (g *generator) runOpen(run, ctx context.Context) {
+	interval := time.Duration(float64(time.Second) / g.rate)
+	inFlight := make(chan struct{}, g.concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for due := time.Now(); ; due = due.Add(interval) {
+		timer.Reset(time.Until(due))
+		select {
+		case <-run.Done():
+			return
+		case <-timer.C:
+		}
+		select {
+		case inFlight <- struct{}{}:
+			wg.Add(1)
+			go func(due time.Time) {
+				defer wg.Done()
+				defer func() { <-inFlight }()
+				g.send(ctx, due)
+			}(due)
+		default:
+			g.mu.Lock()
+			g.skipped++
+			g.mu.Unlock()
+		}
+	}
+}
+
+// runClosed has concurrency workers send requests back to back until run is
+// done, at most rate per second in total if rate is positive.
+func (g *generator) runClosed(run, ctx context.Context) {
+	var tokens <-chan time.Time
+	if g.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / g.rate))
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+	var wg sync.WaitGroup
+	for range g.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if tokens != nil {
+					select {
+					case <-run.Done():
+						return
+					case <-tokens:
+					}
+				} else if run.Err() != nil {
+					return
+				}
+				g.send(ctx, time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// pick chooses a payload at random, in proportion to its weight.
+func (g *generator) pick() int {
+	return g.payloadAt(rand.IntN(g.totalWeight))
+}
+
+// payloadAt returns the payload covering n when the payloads are laid end
+// to end, each as wide as its weight.
+func (g *generator) payloadAt(n int) int {
+	for i, p := range g.payloads {
+		if n < p.weight {
+			return i
+		}
+		n -= p.weight
+	}
+	return len(g.payloads) - 1
+}
+
+func (g *generator) send(ctx context.Context, start time.Time) {
+	i := g.pick()
+	outcome := g.do(ctx, g.payloads[i].body)
+	if ctx.Err() != nil {
+		// Interrupted: neither a success nor a failure of the server.
+		return
+	}
+	latency := time.Since(start)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := &g.results[i]
+	s.latencies = append(s.latencies, latency)
+	if outcome != "" {
+		s.failed++
+		s.errors[outcome]++
+	}
+}
+
+// do sends one request and returns "" if it succeeded, or what went wrong.
+func (g *generator) do(ctx context.Context, body []byte) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.url, bytes.NewReader(body))
+	if err != nil {
+		return err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := g.client.Do(req)
+	if err != nil {
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return "timeout"
+		}
+		return "transport error"
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode/100 != 2 {
+		return "HTTP " + strconv.Itoa(res.StatusCode)
+	}
+	return ""
+}
+
+// summary describes a set of requests.
+type summary struct {
+	sent, failed int
+	errors       map[string]int
+	latencies    []time.Duration // sorted
+}
+
+func summarize(stats ...payloadStats) summary {
+	s := summary{errors: map[string]int{}}
+	for _, p := range stats {
+		s.sent += len(p.latencies)
+		s.failed += p.failed
+		s.latencies = append(s.latencies, p.latencies...)
+		for k, v := range p.errors {
+			s.errors[k] += v
+		}
+	}
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	return s
+}
+
+func (s summary) errorRate() float64 {
+	if s.sent == 0 {
+		return 0
+	}
+	return float64(s.failed) / float64(s.sent)
+}
+
+// percentile returns the latency within which a fraction q of the requests
+// completed, by the nearest-rank method.
+func (s summary) percentile(q float64) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(s.latencies)))) - 1
+	return s.latencies[min(max(i, 0), len(s.latencies)-1)]
+}
+
+func (s summary) mean() time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, l := range s.latencies {
+		total += l
+	}
+	return total / time.Duration(len(s.latencies))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPayloadFlagSet(t *testing.T) {
+	tests := []struct {
+		in         string
+		wantWeight int
+		wantBody   string
+		wantErr    bool
+	}{
+		{in: "{}", wantWeight: 1, wantBody: "{}"},
+		{in: `3:{"fail":"service-d"}`, wantWeight: 3, wantBody: `{"fail":"service-d"}`},
+		{in: ` 2 : {"repeat":2} `, wantWeight: 2, wantBody: `{"repeat":2}`},
+		{in: `{"message":"a:b"}`, wantWeight: 1, wantBody: `{"message":"a:b"}`},
+		{in: "0:{}", wantErr: true},
+		{in: "-1:{}", wantErr: true},
+		{in: "x:{}", wantErr: true},
+		{in: "3:{", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		var f payloadFlag
+		err := f.Set(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Set(%q) = nil, want error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q) = %v", tt.in, err)
+			continue
+		}
+		if len(f) != 1 || f[0].weight != tt.wantWeight || string(f[0].body) != tt.wantBody {
+			t.Errorf("Set(%q) = %s, want %d:%s", tt.in, f.String(), tt.wantWeight, tt.wantBody)
+		}
+	}
+}
+
+func TestPayloadFlagRepeated(t *testing.T) {
+	var f payloadFlag
+	for _, v := range []string{"8:{}", `1:{"fail":"service-d"}`} {
+		if err := f.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := f.String(), `8:{} 1:{"fail":"service-d"}`; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
+
+func TestPayloadAt(t *testing.T) {
+	g := newGenerator(nil, "", []payload{{weight: 2}, {weight: 1}, {weight: 3}}, 1, 1)
+	want := []int{0, 0, 1, 2, 2, 2}
+	if g.totalWeight != len(want) {
+		t.Fatalf("total weight = %d, want %d", g.totalWeight, len(want))
+	}
+	for n, w := range want {
+		if got := g.payloadAt(n); got != w {
+			t.Errorf("payloadAt(%d) = %d, want %d", n, got, w)
+		}
+	}
+	for range 100 {
+		if i := g.pick(); i < 0 || i >= len(g.payloads) {
+			t.Fatalf("pick() = %d, out of range", i)
+		}
+	}
+}
+
+func millis(n ...int) []time.Duration {
+	out := make([]time.Duration, len(n))
+	for i, v := range n {
+		out[i] = time.Duration(v) * time.Millisecond
+	}
+	return out
+}
+
+func TestPercentile(t *testing.T) {
+	// Two payloads, merged and sorted: 1ms to 10ms.
+	s := summarize(
+		payloadStats{latencies: millis(10, 2, 8, 4, 6), failed: 1, errors: map[string]int{"HTTP 500": 1}},
+		payloadStats{latencies: millis(1, 9, 3, 7, 5), failed: 2, errors: map[string]int{"HTTP 500": 1, "timeout": 1}},
+	)
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{0.1, time.Millisecond},
+		{0.11, 2 * time.Millisecond},
+		{0.5, 5 * time.Millisecond},
+		{0.9, 9 * time.Millisecond},
+		{0.95, 10 * time.Millisecond},
+		{0.99, 10 * time.Millisecond},
+		{1, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := s.percentile(tt.q); got != tt.want {
+			t.Errorf("percentile(%g) = %s, want %s", tt.q, got, tt.want)
+		}
+	}
+	if got := s.mean(); got != 5500*time.Microsecond {
+		t.Errorf("mean() = %s, want 5.5ms", got)
+	}
+	if s.sent != 10 || s.failed != 3 || s.errorRate() != 0.3 {
+		t.Errorf("sent, failed, error rate = %d, %d, %g, want 10, 3, 0.3", s.sent, s.failed, s.errorRate())
+	}
+	if s.errors["HTTP 500"] != 2 || s.errors["timeout"] != 1 {
+		t.Errorf("errors = %v", s.errors)
+	}
+
+	if got := summarize(payloadStats{latencies: millis(7)}).percentile(0.99); got != 7*time.Millisecond {
+		t.Errorf("percentile of a single request = %s, want 7ms", got)
+	}
+	if got := summarize().percentile(0.5); got != 0 {
+		t.Errorf("percentile of no requests = %s, want 0", got)
+	}
+}
@@ -0,0 +1,191 @@
+// Command loadgen drives service A's /start endpoint to produce traces.
+//
+// In open-loop mode (the default) it sends -rate requests per second
+// whatever the latency, like independent users would; in closed-loop mode
+// -concurrency workers send requests back to back. Each request POSTs one of
+// the -payload bodies, picked by weight. At the end it reports latency
+// percentiles and error rates, overall and per payload.
+//
+// Every request carries a loadgen.run_id baggage member, so that services
+// copying loadgen.* baggage onto their spans (OTEL_BAGGAGE_SPAN_ATTRIBUTES)
+// let a whole run be found in Jaeger.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"go.opentelemetry.io/otel/baggage"
+
+	"telemetry"
+)
+
+func main() {
+	url := flag.String("url", "http://localhost:8088/start", "`URL` of service A's /start endpoint")
+	mode := flag.String("mode", "open", "`open` (send at -rate whatever the latency) or closed (-concurrency workers back to back)")
+	rate := flag.Float64("rate", 10, "requests per second; in closed mode an upper bound, 0 for none")
+	concurrency := flag.Int("concurrency", 10, "workers in closed mode, most requests in flight in open mode")
+	duration := flag.Duration("duration", 30*time.Second, "how long to send requests")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each request")
+	runID := flag.String("run-id", "", "value of the loadgen.run_id baggage member (default random)")
+	var payloads payloadFlag
+	flag.Var(&payloads, "payload", "`[weight:]json` body of POST /start, e.g. '1:{\"fail\":\"service-d\"}'; repeatable (default {})")
+	flag.Parse()
+
+	if len(payloads) == 0 {
+		payloads = payloadFlag{{weight: 1, body: []byte("{}")}}
+	}
+	if *runID == "" {
+		*runID = newRunID()
+	}
+	if err := validate(*mode, *rate, *concurrency, *duration); err != nil {
+		fmt.Fprintln(os.Stderr, "loadgen:", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// loadgen runs next to the services, so its admin listener takes any
+	// free port rather than one of theirs.
+	adminAddr := os.Getenv("ADMIN_ADDR")
+	if adminAddr == "" {
+		adminAddr = "localhost:0"
+	}
+	shutdown, err := telemetry.Setup(ctx, telemetry.WithServiceName("loadgen"), telemetry.WithAdminAddr(adminAddr))
+	if err != nil {
+		slog.Error("failed to initialize telemetry", "error", err)
+		os.Exit(1)
+	}
+
+	member, err := baggage.NewMember("loadgen.run_id", *runID)
+	if err != nil {
+		slog.Error("invalid run id", "error", err)
+		os.Exit(1)
+	}
+	bag, _ := baggage.New(member)
+	ctx = baggage.ContextWithBaggage(ctx, bag)
+
+	client := &http.Client{
+		Transport: telemetry.NewHTTPTransport("service-a", http.DefaultTransport),
+		Timeout:   *timeout,
+	}
+	g := newGenerator(client, *url, payloads, *rate, *concurrency)
+
+	fmt.Printf("run %s: %s loop, %s for %s against %s\n", *runID, *mode, load(*mode, *rate, *concurrency), *duration, *url)
+	run, cancel := context.WithTimeout(ctx, *duration)
+	start := time.Now()
+	if *mode == "open" {
+		g.runOpen(run, ctx)
+	} else {
+		g.runClosed(run, ctx)
+	}
+	cancel()
+	elapsed := time.Since(start)
+	stop()
+
+	g.report(os.Stdout, elapsed)
+	fmt.Printf("\nFind the run in Jaeger with the tag loadgen.run_id=%s\n", *runID)
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), telemetry.ShutdownTimeout())
+	defer cancel()
+	if err := shutdown(flushCtx); err != nil {
+		slog.Error("error shutting down telemetry", "error", err)
+		os.Exit(1)
+	}
+}
+
+func validate(mode string, rate float64, concurrency int, duration time.Duration) error {
+	switch {
+	case mode != "open" && mode != "closed":
+		return fmt.Errorf("invalid -mode %q: want open or closed", mode)
+	case mode == "open" && rate <= 0:
+		return fmt.Errorf("invalid -rate %v: open mode needs a positive rate", rate)
+	case rate < 0:
+		return fmt.Errorf("invalid -rate %v", rate)
+	case concurrency < 1:
+		return fmt.Errorf("invalid -concurrency %d", concurrency)
+	case duration <= 0:
+		return fmt.Errorf("invalid -duration %v", duration)
+	}
+	return nil
+}
+
+func load(mode string, rate float64, concurrency int) string {
+	switch {
+	case mode == "open":
+		return fmt.Sprintf("%g req/s (at most %d in flight)", rate, concurrency)
+	case rate > 0:
+		return fmt.Sprintf("%d workers, at most %g req/s", concurrency, rate)
+	default:
+		return fmt.Sprintf("%d workers", concurrency)
+	}
+}
+
+func newRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// report writes the latency percentiles and error rates of the run, overall
+// and per payload.
+func (g *generator) report(w io.Writer, elapsed time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	all := summarize(g.results...)
+	fmt.Fprintf(w, "\nrequests    %d sent, %d failed (%.2f%%)", all.sent, all.failed, 100*all.errorRate())
+	if g.skipped > 0 {
+		fmt.Fprintf(w, ", %d skipped at the concurrency limit", g.skipped)
+	}
+	fmt.Fprintf(w, "\nthroughput  %.2f req/s\n", float64(all.sent)/elapsed.Seconds())
+	fmt.Fprintf(w, "latency     mean %s  p50 %s  p90 %s  p95 %s  p99 %s  max %s\n",
+		ms(all.mean()), ms(all.percentile(0.5)), ms(all.percentile(0.9)),
+		ms(all.percentile(0.95)), ms(all.percentile(0.99)), ms(all.percentile(1)))
+	for _, e := range sortedErrors(all.errors) {
+		fmt.Fprintf(w, "errors      %d %s\n", all.errors[e], e)
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WEIGHT\tSENT\tERRORS\tP50\tP99\tPAYLOAD")
+	for i, p := range g.payloads {
+		s := summarize(g.results[i])
+		fmt.Fprintf(tw, "%d\t%d\t%.2f%%\t%s\t%s\t%s\n",
+			p.weight, s.sent, 100*s.errorRate(), ms(s.percentile(0.5)), ms(s.percentile(0.99)), p.body)
+	}
+	_ = tw.Flush()
+}
+
+func sortedErrors(errs map[string]int) []string {
+	keys := make([]string, 0, len(errs))
+	for k := range errs {
+		keys = append(keys, k)
+	}
+	// Most frequent first.
+	sort.Slice(keys, func(i, j int) bool {
+		if errs[keys[i]] != errs[keys[j]] {
+			return errs[keys[i]] > errs[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d.Microseconds())/1000)
+}
@@ -2,101 +2,92 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"flag"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 
+	"discovery"
 	pb "proto"
-
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"telemetry"
 )
 
 var tracer trace.Tracer
 
 func main() {
-	tp := initTracer()
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Fatalf("error shutting down tracer provider: %v", err)
-		}
-	}()
-
-	tracer = otel.Tracer("service-a")
-
-	mux := http.NewServeMux()
-	mux.Handle("/start", otelhttp.NewHandler(http.HandlerFunc(handler), "StartHandler"))
+	addr := flag.String("addr", ":8088", "`address` to listen on")
+	discoveryFlags := discovery.RegisterFlags(flag.CommandLine)
+	flag.Parse()
 
-	log.Println("Listening on :8088")
-	log.Fatal(http.ListenAndServe(":8088", mux))
-}
-
-func handler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	ctx, span := tracer.Start(ctx, "call-service-b")
-	defer span.End()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	conn, err := grpc.NewClient(
-		"service-b:50051",
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
-	)
+	shutdown, err := telemetry.Setup(ctx, telemetry.WithServiceName("service-a"))
 	if err != nil {
-		http.Error(w, "could not connect to service-b", http.StatusInternalServerError)
-		return
+		slog.Error("failed to initialize telemetry", "error", err)
+		os.Exit(1)
 	}
-	defer conn.Close()
 
-	client := pb.NewServiceBClient(conn)
+	tracer = otel.Tracer("service-a")
 
-	res, err := client.DoSomething(ctx, &pb.Request{Message: "Hello from A"})
+	endpoints, err := discovery.New(discoveryFlags)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("error calling B: %v", err), http.StatusInternalServerError)
-		return
+		slog.Error("failed to load service registry", "error", err)
+		os.Exit(1)
 	}
-
-	fmt.Fprintf(w, "Response from B: %s", res.Result)
-}
-
-func initTracer() *sdktrace.TracerProvider {
-	exporter, err := otlptracegrpc.New(
-		context.Background(),
-		otlptracegrpc.WithEndpoint(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
-		otlptracegrpc.WithInsecure(),
-	)
+	serviceB, err := endpoints.Endpoint("service-b", "service-b:50051")
 	if err != nil {
-		log.Fatalf("failed to create exporter: %v", err)
+		slog.Error("failed to configure service-b", "error", err)
+		os.Exit(1)
 	}
-
-	res, err := resource.New(
-		context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("service-a"),
-		),
-	)
+	conn, err := telemetry.NewGRPCClient(serviceB.Target(), serviceB.DialOptions()...)
 	if err != nil {
-		log.Fatalf("failed to create resource: %v", err)
+		slog.Error("failed to create service-b client", "error", err)
+		os.Exit(1)
 	}
 
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
+	mux := http.NewServeMux()
+	mux.Handle("/start", telemetry.NewHTTPHandler(&startHandler{serviceB: pb.NewServiceBClient(conn)}, "StartHandler"))
+
+	slog.Info("listening", "addr", *addr)
+	srv := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
 
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	var failed bool
+	select {
+	case err := <-serveErr:
+		slog.Error("failed to serve", "error", err)
+		failed = true
+	case <-ctx.Done():
+		slog.Info("shutting down", "cause", context.Cause(ctx))
+	}
+	stop()
 
-	return tp
+	drainCtx, cancel := context.WithTimeout(context.Background(), telemetry.ShutdownTimeout())
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		slog.Error("failed to drain http server", "error", err)
+	}
+	if err := conn.Close(); err != nil {
+		slog.Error("failed to close service-b client", "error", err)
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), telemetry.ShutdownTimeout())
+	defer cancel()
+	if err := shutdown(flushCtx); err != nil {
+		slog.Error("error shutting down telemetry", "error", err)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "proto"
+	"telemetry"
+)
+
+const (
+	defaultMessage  = "Hello from A"
+	maxMessageBytes = 1024
+	maxRepeat       = 100
+	maxRequestBytes = 64 << 10
+)
+
+var errUnsupportedMediaType = errors.New("unsupported content type: use application/json")
+
+// chain lists the services a /start request travels through, in order: B
+// calls C and then D, D calls E.
+var chain = []string{"service-a", "service-b", "service-c", "service-d", "service-e"}
+
+// startRequest is the JSON body of POST /start. GET /start takes the same
+// fields as query parameters.
+type startRequest struct {
+	// Message is sent down the chain; every service appends itself to it.
+	Message string `json:"message"`
+	// Repeat is how many times service B is called, one after the other.
+	Repeat int `json:"repeat"`
+	// Target is the last service the request travels to, service-e by
+	// default.
+	Target string `json:"target"`
+	// Fail names a service on the way to Target that fails the request.
+	Fail string `json:"fail"`
+}
+
+type startResponse struct {
+	TraceID    string      `json:"trace_id"`
+	Message    string      `json:"message"`
+	Target     string      `json:"target"`
+	Calls      []startCall `json:"calls"`
+	DurationMS float64     `json:"duration_ms"`
+}
+
+// startCall is one call down the chain, with the time spent in each hop:
+// the call to service B, then the hops B reported in its server-timing
+// trailer.
+type startCall struct {
+	Result string `json:"result"`
+	Hops   []hop  `json:"hops"`
+}
+
+type hop struct {
+	Service    string  `json:"service"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// startHandler serves /start by calling service B over a connection shared
+// by all requests.
+type startHandler struct {
+	serviceB pb.ServiceBClient
+}
+
+func (h *startHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeProblem(w, r, problem{Status: http.StatusMethodNotAllowed})
+		return
+	}
+	req, err := parseStartRequest(w, r)
+	if errors.Is(err, errUnsupportedMediaType) {
+		writeProblem(w, r, problem{Status: http.StatusUnsupportedMediaType, Detail: err.Error()})
+		return
+	}
+	if err != nil {
+		writeProblem(w, r, problem{Status: http.StatusBadRequest, Detail: err.Error()})
+		return
+	}
+	if invalid := req.validate(); len(invalid) > 0 {
+		writeProblem(w, r, problem{
+			Status:        http.StatusBadRequest,
+			Detail:        "the request has invalid parameters",
+			InvalidParams: invalid,
+		})
+		return
+	}
+
+	// Tag the whole A→E chain with where it started and how far it goes;
+	// downstream services read it back from the propagated baggage.
+	members := map[string]string{"origin": "service-a", "chain.target": req.Target}
+	if req.Fail != "" {
+		members["chain.fail"] = req.Fail
+	}
+	bag := baggage.FromContext(ctx)
+	for key, value := range members {
+		if m, err := baggage.NewMember(key, value); err == nil {
+			if b, err := bag.SetMember(m); err == nil {
+				bag = b
+			}
+		}
+	}
+	ctx = baggage.ContextWithBaggage(ctx, bag)
+
+	if req.Fail == "service-a" {
+		writeProblem(w, r, problem{Status: http.StatusInternalServerError, Detail: "simulated failure in service-a"})
+		return
+	}
+
+	res := startResponse{
+		TraceID: trace.SpanContextFromContext(ctx).TraceID().String(),
+		Message: req.Message,
+		Target:  req.Target,
+		Calls:   make([]startCall, 0, req.Repeat),
+	}
+	for i := range req.Repeat {
+		call, err := h.callServiceB(ctx, req.Message, i)
+		if err != nil {
+			writeProblem(w, r, downstreamProblem("service-b", err))
+			return
+		}
+		res.Calls = append(res.Calls, call)
+	}
+	res.DurationMS = milliseconds(time.Since(start))
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(res)
+}
+
+func (h *startHandler) callServiceB(ctx context.Context, message string, i int) (startCall, error) {
+	ctx, span := tracer.Start(ctx, "call-service-b", trace.WithAttributes(attribute.Int("call.index", i)))
+	defer span.End()
+
+	var trailer metadata.MD
+	start := time.Now()
+	res, err := h.serviceB.DoSomething(ctx, &pb.Request{Message: message}, grpc.Trailer(&trailer))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, "error calling B")
+		return startCall{}, err
+	}
+	call := startCall{
+		Result: res.Result,
+		Hops:   []hop{{Service: "service-b", DurationMS: milliseconds(time.Since(start))}},
+	}
+	for _, t := range telemetry.ParseServerTiming(trailer.Get("server-timing")...) {
+		if t.Name != "total" {
+			call.Hops = append(call.Hops, hop{Service: t.Name, DurationMS: milliseconds(t.Duration)})
+		}
+	}
+	return call, nil
+}
+
+// parseStartRequest reads the query parameters and, for POST, the JSON
+// body, whose fields take precedence.
+func parseStartRequest(w http.ResponseWriter, r *http.Request) (startRequest, error) {
+	req := startRequest{Message: defaultMessage, Repeat: 1, Target: "service-e"}
+
+	q := r.URL.Query()
+	if v := q.Get("message"); v != "" {
+		req.Message = v
+	}
+	if v := q.Get("repeat"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return req, fmt.Errorf("invalid repeat %q: not an integer", v)
+		}
+		req.Repeat = n
+	}
+	if v := q.Get("target"); v != "" {
+		req.Target = v
+	}
+	if v := q.Get("fail"); v != "" {
+		req.Fail = v
+	}
+
+	if r.Method == http.MethodPost {
+		if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "application/json") {
+			return req, fmt.Errorf("%w, not %q", errUnsupportedMediaType, ct)
+		}
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			return req, fmt.Errorf("invalid JSON body: %v", err)
+		}
+	}
+
+	req.Target = serviceName(req.Target)
+	req.Fail = serviceName(req.Fail)
+	return req, nil
+}
+
+func (req startRequest) validate() []invalidParam {
+	var invalid []invalidParam
+	if req.Message == "" || len(req.Message) > maxMessageBytes {
+		invalid = append(invalid, invalidParam{"message", fmt.Sprintf("must be between 1 and %d bytes long", maxMessageBytes)})
+	}
+	if req.Repeat < 1 || req.Repeat > maxRepeat {
+		invalid = append(invalid, invalidParam{"repeat", fmt.Sprintf("must be between 1 and %d", maxRepeat)})
+	}
+	target := slices.Index(chain, req.Target)
+	if target < 1 {
+		invalid = append(invalid, invalidParam{"target", "must be one of " + strings.Join(chain[1:], ", ")})
+	}
+	if req.Fail != "" {
+		switch fail := slices.Index(chain, req.Fail); {
+		case fail < 0:
+			invalid = append(invalid, invalidParam{"fail", "must be one of " + strings.Join(chain, ", ")})
+		case target > 0 && fail > target:
+			invalid = append(invalid, invalidParam{"fail", "must be on the way to " + req.Target})
+		}
+	}
+	return invalid
+}
+
+// serviceName accepts "c" as well as "service-c".
+func serviceName(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s != "" && !strings.HasPrefix(s, "service-") {
+		s = "service-" + s
+	}
+	return s
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// problem is an RFC 7807 problem details object.
+type problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	TraceID       string         `json:"trace_id,omitempty"`
+	Service       string         `json:"service,omitempty"`
+	InvalidParams []invalidParam `json:"invalid_params,omitempty"`
+}
+
+type invalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// downstreamProblem reports a failed call to service: 504 if it timed out,
+// 503 if it could not be reached and 502 otherwise.
+func downstreamProblem(service string, err error) problem {
+	p := problem{Status: http.StatusBadGateway, Service: service, Detail: err.Error()}
+	if s, ok := status.FromError(err); ok {
+		p.Detail = s.Message()
+		switch s.Code() {
+		case codes.DeadlineExceeded:
+			p.Status = http.StatusGatewayTimeout
+		case codes.Unavailable:
+			p.Status = http.StatusServiceUnavailable
+		}
+	}
+	return p
+}
+
+// writeProblem writes p as application/problem+json. Problems have no
+// type of their own: the status code and the extension members tell them
+// apart.
+func writeProblem(w http.ResponseWriter, r *http.Request, p problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		p.TraceID = sc.TraceID().String()
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(p)
+}
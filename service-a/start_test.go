@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "proto"
+	"telemetry"
+)
+
+// fakeServiceB answers with the message it received followed by its name,
+// or fails with err. An unhealthy one starts out reporting NOT_SERVING.
+type fakeServiceB struct {
+	pb.UnimplementedServiceBServer
+	name      string
+	err       error
+	unhealthy bool
+}
+
+func (s *fakeServiceB) DoSomething(_ context.Context, req *pb.Request) (*pb.Response, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &pb.Response{Result: req.Message + " -> " + s.name}, nil
+}
+
+// backend is a service-b instance listening on an in-memory connection.
+type backend struct {
+	lis    *bufconn.Listener
+	health *health.Server
+}
+
+// newStartHandler serves the fake backends, named by their address, and
+// returns a /start handler calling them through the client the service
+// uses, resolved to every backend.
+func newStartHandler(t *testing.T, backends map[string]*fakeServiceB) (http.Handler, map[string]*backend) {
+	t.Helper()
+	tracer = otel.Tracer("service-a")
+
+	running := make(map[string]*backend, len(backends))
+	var addrs []resolver.Address
+	for addr, svc := range backends {
+		b := &backend{lis: bufconn.Listen(1 << 20), health: health.NewServer()}
+		if svc.unhealthy {
+			b.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		}
+		srv := grpc.NewServer()
+		pb.RegisterServiceBServer(srv, svc)
+		healthpb.RegisterHealthServer(srv, b.health)
+		go srv.Serve(b.lis)
+		t.Cleanup(srv.Stop)
+		running[addr] = b
+		addrs = append(addrs, resolver.Address{Addr: addr})
+	}
+
+	r := manual.NewBuilderWithScheme("bufconn")
+	r.InitialState(resolver.State{Addresses: addrs})
+	conn, err := telemetry.NewGRPCClient(r.Scheme()+":///service-b",
+		grpc.WithResolvers(r),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return running[addr].lis.DialContext(ctx)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &startHandler{serviceB: pb.NewServiceBClient(conn)}, running
+}
+
+// results calls /start and returns how many calls each backend answered.
+func results(t *testing.T, h http.Handler, repeat string) map[string]int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/start?message=hi&repeat="+repeat, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/start returned %d: %s", w.Code, w.Body)
+	}
+	var res startResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, c := range res.Calls {
+		name, ok := strings.CutPrefix(c.Result, "hi -> ")
+		if !ok {
+			t.Fatalf("unexpected result %q", c.Result)
+		}
+		counts[name]++
+	}
+	return counts
+}
+
+// eventually calls /start until cond holds for the calls each backend
+// answered.
+func eventually(t *testing.T, h http.Handler, cond func(map[string]int) bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		counts := results(t, h, "10")
+		if cond(counts) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("calls answered by %v", counts)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestStartRoundRobin(t *testing.T) {
+	h, _ := newStartHandler(t, map[string]*fakeServiceB{
+		"b1": {name: "b1"},
+		"b2": {name: "b2"},
+	})
+	eventually(t, h, func(counts map[string]int) bool {
+		return counts["b1"] > 0 && counts["b2"] > 0
+	})
+	// Once both are ready, calls alternate between them.
+	if counts := results(t, h, "10"); counts["b1"] != 5 || counts["b2"] != 5 {
+		t.Errorf("calls answered by %v, want 5 each", counts)
+	}
+}
+
+func TestStartSkipsUnhealthyBackend(t *testing.T) {
+	h, backends := newStartHandler(t, map[string]*fakeServiceB{
+		"b1": {name: "b1"},
+		"b2": {name: "b2", unhealthy: true},
+	})
+
+	for range 3 {
+		if counts := results(t, h, "10"); counts["b2"] != 0 {
+			t.Fatalf("calls answered by %v, want none by the unhealthy b2", counts)
+		}
+	}
+
+	backends["b2"].health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	eventually(t, h, func(counts map[string]int) bool { return counts["b2"] > 0 })
+}
+
+func TestStartDownstreamStatus(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want int
+	}{
+		{codes.Unavailable, http.StatusServiceUnavailable},
+		{codes.DeadlineExceeded, http.StatusGatewayTimeout},
+		{codes.Internal, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			h, _ := newStartHandler(t, map[string]*fakeServiceB{
+				"b1": {name: "b1", err: status.Error(tt.code, "error calling C")},
+			})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/start", nil))
+			if w.Code != tt.want {
+				t.Errorf("/start returned %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var p problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Service != "service-b" || p.Detail != "error calling C" {
+				t.Errorf("problem = %+v, want service-b and the status message", p)
+			}
+		})
+	}
+}
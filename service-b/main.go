@@ -3,57 +3,119 @@ package main
 import (
 	"bytes"
 	"context"
-	"fmt"
+	"encoding/json"
+	"errors"
+	"flag"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
-	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/trace"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 
+	"discovery"
 	pb "proto"
+	"telemetry"
 )
 
 var tracer trace.Tracer
 
 type serverB struct {
 	pb.UnimplementedServiceBServer
+	serviceC pb.ServiceCClient
+	serviceD *discovery.Endpoint
 }
 
 func main() {
-	tp := initTracer()
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Fatalf("error shutting down tracer provider: %v", err)
-		}
-	}()
+	addr := flag.String("addr", ":50051", "`address` to listen on")
+	discoveryFlags := discovery.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdown, err := telemetry.Setup(ctx, telemetry.WithServiceName("service-b"))
+	if err != nil {
+		slog.Error("failed to initialize telemetry", "error", err)
+		os.Exit(1)
+	}
 
 	tracer = otel.Tracer("service-b")
 
-	lis, err := net.Listen("tcp", ":50051")
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		slog.Error("failed to listen", "error", err)
+		os.Exit(1)
+	}
+
+	endpoints, err := discovery.New(discoveryFlags)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		slog.Error("failed to load service registry", "error", err)
+		os.Exit(1)
 	}
+	serviceC, err := endpoints.Endpoint("service-c", "service-c:50052")
+	if err != nil {
+		slog.Error("failed to configure service-c", "error", err)
+		os.Exit(1)
+	}
+	serviceD, err := endpoints.Endpoint("service-d", "service-d:8089")
+	if err != nil {
+		slog.Error("failed to configure service-d", "error", err)
+		os.Exit(1)
+	}
+	conn, err := telemetry.NewGRPCClient(serviceC.Target(), serviceC.DialOptions()...)
+	if err != nil {
+		slog.Error("failed to create service-c client", "error", err)
+		os.Exit(1)
+	}
+
+	grpcServer := telemetry.NewGRPCServer()
+	pb.RegisterServiceBServer(grpcServer, &serverB{serviceC: pb.NewServiceCClient(conn), serviceD: serviceD})
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	slog.Info("listening", "addr", *addr)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- grpcServer.Serve(lis)
+	}()
 
-	grpcServer := grpc.NewServer(
-		grpc.StatsHandler(otelgrpc.NewServerHandler()),
-	)
-	pb.RegisterServiceBServer(grpcServer, &serverB{})
+	var failed bool
+	select {
+	case err := <-serveErr:
+		slog.Error("failed to serve", "error", err)
+		failed = true
+	case <-ctx.Done():
+		slog.Info("shutting down", "cause", context.Cause(ctx))
+	}
+	stop()
+
+	// Let clients balance away from this instance while it drains.
+	healthServer.Shutdown()
+	drainCtx, cancel := context.WithTimeout(context.Background(), telemetry.ShutdownTimeout())
+	defer cancel()
+	telemetry.GracefulStop(drainCtx, grpcServer)
+	if err := conn.Close(); err != nil {
+		slog.Error("failed to close service-c client", "error", err)
+	}
 
-	log.Println("Service B listening on :50051")
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	flushCtx, cancel := context.WithTimeout(context.Background(), telemetry.ShutdownTimeout())
+	defer cancel()
+	if err := shutdown(flushCtx); err != nil {
+		slog.Error("error shutting down telemetry", "error", err)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
 	}
 }
 
@@ -61,83 +123,83 @@ func (s *serverB) DoSomething(ctx context.Context, req *pb.Request) (*pb.Respons
 	ctx, span := tracer.Start(ctx, "DoSomething in B")
 	defer span.End()
 
-	// Call service C
-	conn, err := grpc.NewClient(
-		"service-c:50052",
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("could not connect to service-c: %w", err)
+	// service-a's /start can make the chain fail here or stop early.
+	bag := baggage.FromContext(ctx)
+	if bag.Member("chain.fail").Value() == "service-b" {
+		return nil, status.Error(codes.Internal, "simulated failure in service-b")
+	}
+	target := bag.Member("chain.target").Value()
+	if target == "service-b" {
+		return &pb.Response{Result: req.Message + " -> B"}, nil
 	}
-	defer conn.Close()
 
-	client := pb.NewServiceCClient(conn)
-	res, err := client.DoSomethingElse(ctx, &pb.Request{Message: req.Message + " -> B"})
+	// Call service C. Its status code tells service A whether C timed out
+	// or could not be reached.
+	res, err := s.serviceC.DoSomethingElse(ctx, &pb.Request{Message: req.Message + " -> B"})
 	if err != nil {
-		return nil, fmt.Errorf("error calling C: %w", err)
+		return nil, status.Errorf(status.Code(err), "error calling C: %s", status.Convert(err).Message())
+	}
+	if target == "service-c" {
+		return &pb.Response{Result: res.Result}, nil
 	}
 
-	body, err := callServiceD(ctx)
+	// D carries on from where C left the message.
+	result, err := callServiceD(ctx, s.serviceD, res.Result)
 	if err != nil {
-		return nil, fmt.Errorf("error calling D: %w", err)
+		return nil, status.Errorf(status.Code(err), "error calling D: %s", status.Convert(err).Message())
 	}
 
-	return &pb.Response{Result: res.Result + " -> B" + body}, nil
+	return &pb.Response{Result: result}, nil
 }
 
-func initTracer() *sdktrace.TracerProvider {
-	exporter, err := otlptracegrpc.New(
-		context.Background(),
-		otlptracegrpc.WithEndpoint(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
-		otlptracegrpc.WithInsecure(),
-	)
-	if err != nil {
-		log.Fatalf("failed to create exporter: %v", err)
-	}
+// serviceDClient calls service D, recording each call in the server-timing
+// trailer of the DoSomething call it serves. Calls share its connections.
+var serviceDClient = &http.Client{Transport: telemetry.NewHTTPTransport("service-d", http.DefaultTransport)}
 
-	res, err := resource.New(
-		context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("service-b"),
-		),
-	)
+// callServiceD posts message to service D and returns its reply. Errors are
+// gRPC statuses: Unavailable when D could not be reached, DeadlineExceeded
+// when it timed out.
+func callServiceD(ctx context.Context, serviceD *discovery.Endpoint, message string) (string, error) {
+	addr, err := serviceD.Addr(ctx)
 	if err != nil {
-		log.Fatalf("failed to create resource: %v", err)
+		return "", status.Error(codes.Unavailable, err.Error())
 	}
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
-
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	return tp
-}
-
-func callServiceD(ctx context.Context) (string, error) {
-	client := http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	payload, err := json.Marshal(map[string]string{"message": message})
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", "http://service-d:8089/hello", bytes.NewBuffer([]byte("{\"message\": \"Hello from B\"}")))
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://"+addr+"/hello", bytes.NewReader(payload))
 	if err != nil {
-		return "", err
+		return "", status.Error(codes.Internal, err.Error())
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	res, err := client.Do(req)
+	res, err := serviceDClient.Do(req)
 	if err != nil {
-		return "", err
+		code := codes.Unavailable
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+			code = codes.DeadlineExceeded
+		}
+		return "", status.Error(code, err.Error())
 	}
 	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return "", err
+		return "", status.Error(codes.Unavailable, err.Error())
+	}
+	if res.StatusCode != http.StatusOK {
+		code := codes.Internal
+		switch res.StatusCode {
+		case http.StatusServiceUnavailable:
+			code = codes.Unavailable
+		case http.StatusGatewayTimeout:
+			code = codes.DeadlineExceeded
+		}
+		return "", status.Errorf(code, "service-d returned %s: %s", res.Status, bytes.TrimSpace(body))
 	}
 
-	fmt.Println("Response from D:", string(body))
+	slog.InfoContext(ctx, "response from service-d", "body", string(body))
 	return string(body), nil
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"discovery"
+	pb "proto"
+)
+
+// fakeServiceC appends itself to the message, or fails with err.
+type fakeServiceC struct {
+	pb.UnimplementedServiceCServer
+	err error
+}
+
+func (s fakeServiceC) DoSomethingElse(_ context.Context, req *pb.Request) (*pb.Response, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &pb.Response{Result: req.Message + " -> C"}, nil
+}
+
+// newServerB returns service B calling c over an in-memory connection and
+// service D at dAddr.
+func newServerB(t *testing.T, c fakeServiceC, dAddr string) *serverB {
+	t.Helper()
+	tracer = otel.Tracer("service-b")
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterServiceCServer(srv, c)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///service-c",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	endpoints, err := discovery.New(discovery.WithEndpoint("service-d", dAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceD, err := endpoints.Endpoint("service-d", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &serverB{serviceC: pb.NewServiceCClient(conn), serviceD: serviceD}
+}
+
+// fakeServiceD appends itself to the message it is posted, or answers with
+// code when it is not 200, as service D does when service E fails.
+func fakeServiceD(t *testing.T, code int, received *string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Message string }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*received = req.Message
+		if code != http.StatusOK {
+			http.Error(w, "unavailable", code)
+			return
+		}
+		w.Write([]byte(req.Message + " -> D"))
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func withTarget(t *testing.T, target string) context.Context {
+	t.Helper()
+	m, err := baggage.NewMember("chain.target", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := baggage.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return baggage.ContextWithBaggage(context.Background(), bag)
+}
+
+func TestDoSomethingForwardsMessage(t *testing.T) {
+	tests := []struct {
+		target      string
+		want, wantD string
+	}{
+		{target: "service-b", want: "hi -> B"},
+		{target: "service-c", want: "hi -> B -> C"},
+		{target: "service-d", want: "hi -> B -> C -> D", wantD: "hi -> B -> C"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			var received string
+			s := newServerB(t, fakeServiceC{}, fakeServiceD(t, http.StatusOK, &received))
+			res, err := s.DoSomething(withTarget(t, tt.target), &pb.Request{Message: "hi"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Result != tt.want {
+				t.Errorf("result = %q, want %q", res.Result, tt.want)
+			}
+			if received != tt.wantD {
+				t.Errorf("service-d received %q, want %q", received, tt.wantD)
+			}
+		})
+	}
+}
+
+func TestDoSomethingStatusCode(t *testing.T) {
+	var received string
+	down := httptest.NewServer(http.NotFoundHandler())
+	downAddr := strings.TrimPrefix(down.URL, "http://")
+	down.Close()
+
+	tests := []struct {
+		name  string
+		c     fakeServiceC
+		dAddr string
+		want  codes.Code
+	}{
+		{"c unavailable", fakeServiceC{err: status.Error(codes.Unavailable, "no backend")}, downAddr, codes.Unavailable},
+		{"c timed out", fakeServiceC{err: status.Error(codes.DeadlineExceeded, "too slow")}, downAddr, codes.DeadlineExceeded},
+		{"d down", fakeServiceC{}, downAddr, codes.Unavailable},
+		{"d unavailable", fakeServiceC{}, fakeServiceD(t, http.StatusServiceUnavailable, &received), codes.Unavailable},
+		{"d timed out", fakeServiceC{}, fakeServiceD(t, http.StatusGatewayTimeout, &received), codes.DeadlineExceeded},
+		{"d failed", fakeServiceC{}, fakeServiceD(t, http.StatusInternalServerError, &received), codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServerB(t, tt.c, tt.dAddr)
+			_, err := s.DoSomething(withTarget(t, "service-e"), &pb.Request{Message: "hi"})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("DoSomething() error = %v, want code %s", err, tt.want)
+			}
+		})
+	}
+}
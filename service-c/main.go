@@ -2,22 +2,23 @@ package main
 
 import (
 	"context"
-	"log"
+	"flag"
+	"log/slog"
 	"net"
 	"os"
+	"os/signal"
+	"syscall"
 
-	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/trace"
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 
 	pb "proto"
+	"telemetry"
 )
 
 var tracer trace.Tracer
@@ -27,28 +28,61 @@ type serverC struct {
 }
 
 func main() {
-	tp := initTracer()
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Fatalf("error shutting down tracer provider: %v", err)
-		}
-	}()
+	addr := flag.String("addr", ":50052", "`address` to listen on")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdown, err := telemetry.Setup(ctx, telemetry.WithServiceName("service-c"))
+	if err != nil {
+		slog.Error("failed to initialize telemetry", "error", err)
+		os.Exit(1)
+	}
 
 	tracer = otel.Tracer("service-c")
 
-	lis, err := net.Listen("tcp", ":50052")
+	lis, err := net.Listen("tcp", *addr)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		slog.Error("failed to listen", "error", err)
+		os.Exit(1)
 	}
 
-	grpcServer := grpc.NewServer(
-		grpc.StatsHandler(otelgrpc.NewServerHandler()),
-	)
+	grpcServer := telemetry.NewGRPCServer()
 	pb.RegisterServiceCServer(grpcServer, &serverC{})
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
 
-	log.Println("Service C listening on :50052")
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	slog.Info("listening", "addr", *addr)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- grpcServer.Serve(lis)
+	}()
+
+	var failed bool
+	select {
+	case err := <-serveErr:
+		slog.Error("failed to serve", "error", err)
+		failed = true
+	case <-ctx.Done():
+		slog.Info("shutting down", "cause", context.Cause(ctx))
+	}
+	stop()
+
+	// Let clients balance away from this instance while it drains.
+	healthServer.Shutdown()
+	drainCtx, cancel := context.WithTimeout(context.Background(), telemetry.ShutdownTimeout())
+	defer cancel()
+	telemetry.GracefulStop(drainCtx, grpcServer)
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), telemetry.ShutdownTimeout())
+	defer cancel()
+	if err := shutdown(flushCtx); err != nil {
+		slog.Error("error shutting down telemetry", "error", err)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
 	}
 }
 
@@ -56,37 +90,10 @@ func (s *serverC) DoSomethingElse(ctx context.Context, req *pb.Request) (*pb.Res
 	ctx, span := tracer.Start(ctx, "DoSomethingElse in C")
 	defer span.End()
 
-	result := req.Message + " -> C"
-	return &pb.Response{Result: result}, nil
-}
-
-func initTracer() *sdktrace.TracerProvider {
-	exporter, err := otlptracegrpc.New(
-		context.Background(),
-		otlptracegrpc.WithEndpoint(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
-		otlptracegrpc.WithInsecure(),
-	)
-	if err != nil {
-		log.Fatalf("failed to create exporter: %v", err)
+	if baggage.FromContext(ctx).Member("chain.fail").Value() == "service-c" {
+		return nil, status.Error(codes.Internal, "simulated failure in service-c")
 	}
 
-	res, err := resource.New(
-		context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("service-c"),
-		),
-	)
-	if err != nil {
-		log.Fatalf("failed to create resource: %v", err)
-	}
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
-
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	return tp
+	result := req.Message + " -> C"
+	return &pb.Response{Result: result}, nil
 }
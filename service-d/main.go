@@ -4,45 +4,95 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/trace"
 
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"discovery"
+	"telemetry"
 )
 
 func main() {
-	tp := initTracer()
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Fatalf("error shutting down tracer provider: %v", err)
-		}
-	}()
+	addr := flag.String("addr", ":8089", "`address` to listen on")
+	discoveryFlags := discovery.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdown, err := telemetry.Setup(ctx, telemetry.WithServiceName("service-d"))
+	if err != nil {
+		slog.Error("failed to initialize telemetry", "error", err)
+		os.Exit(1)
+	}
 
 	tracer := otel.Tracer("service-d")
 
+	endpoints, err := discovery.New(discoveryFlags)
+	if err != nil {
+		slog.Error("failed to load service registry", "error", err)
+		os.Exit(1)
+	}
+	serviceE, err := endpoints.Endpoint("service-e", "service-e:8090")
+	if err != nil {
+		slog.Error("failed to configure service-e", "error", err)
+		os.Exit(1)
+	}
+
 	mux := http.NewServeMux()
-	mux.Handle("/hello", otelhttp.NewHandler(http.HandlerFunc(handler(tracer)), "HelloHandler"))
+	mux.Handle("/hello", telemetry.NewHTTPHandler(http.HandlerFunc(handler(tracer, serviceE)), "HelloHandler"))
 
-	log.Println("Listening on :8089")
-	log.Fatal(http.ListenAndServe(":8089", mux))
+	slog.Info("listening", "addr", *addr)
+	srv := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	var failed bool
+	select {
+	case err := <-serveErr:
+		slog.Error("failed to serve", "error", err)
+		failed = true
+	case <-ctx.Done():
+		slog.Info("shutting down", "cause", context.Cause(ctx))
+	}
+	stop()
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), telemetry.ShutdownTimeout())
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		slog.Error("failed to drain http server", "error", err)
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), telemetry.ShutdownTimeout())
+	defer cancel()
+	if err := shutdown(flushCtx); err != nil {
+		slog.Error("error shutting down telemetry", "error", err)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
 }
 
 type Request struct {
 	Message string `json:"message"`
 }
 
-func handler(tracer trace.Tracer) http.HandlerFunc {
+func handler(tracer trace.Tracer, serviceE *discovery.Endpoint) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
@@ -56,10 +106,26 @@ func handler(tracer trace.Tracer) http.HandlerFunc {
 			return
 		}
 
+		// service-a's /start can make the chain fail here or stop early.
+		bag := baggage.FromContext(ctx)
+		if bag.Member("chain.fail").Value() == "service-d" {
+			http.Error(w, "simulated failure in service-d", http.StatusInternalServerError)
+			return
+		}
+		if bag.Member("chain.target").Value() == "service-d" {
+			fmt.Fprint(w, req.Message+" -> D")
+			return
+		}
+
 		// call service e
-		body, err := newGraphQLClient(ctx, tracer)
+		body, err := newGraphQLClient(ctx, tracer, serviceE)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			code := http.StatusInternalServerError
+			var eErr *serviceEError
+			if errors.As(err, &eErr) {
+				code = eErr.code
+			}
+			http.Error(w, err.Error(), code)
 			return
 		}
 
@@ -67,41 +133,29 @@ func handler(tracer trace.Tracer) http.HandlerFunc {
 	}
 }
 
-func initTracer() *sdktrace.TracerProvider {
-	exporter, err := otlptracegrpc.New(
-		context.Background(),
-		otlptracegrpc.WithEndpoint(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
-		otlptracegrpc.WithInsecure(),
-	)
-	if err != nil {
-		log.Fatalf("failed to create exporter: %v", err)
-	}
-
-	res, err := resource.New(
-		context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("service-d"),
-		),
-	)
-	if err != nil {
-		log.Fatalf("failed to create resource: %v", err)
-	}
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
+// graphQLClient calls service E, recording each call in the Server-Timing
+// of the /hello request it serves.
+var graphQLClient = &http.Client{Transport: telemetry.NewHTTPTransport("service-e", http.DefaultTransport)}
 
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	return tp
+// serviceEError is a failed call to service E, with the status /hello
+// answers it with so that service B can tell why the chain failed: 503 when
+// E could not be reached or was unavailable, 504 when it timed out.
+type serviceEError struct {
+	code int
+	err  error
 }
 
-func newGraphQLClient(ctx context.Context, tracer trace.Tracer) (string, error) {
+func (e *serviceEError) Error() string { return e.err.Error() }
+func (e *serviceEError) Unwrap() error { return e.err }
+
+func newGraphQLClient(ctx context.Context, tracer trace.Tracer, serviceE *discovery.Endpoint) (string, error) {
 	ctx, span := tracer.Start(ctx, "newGraphQLClient")
 	defer span.End()
-	url := "http://service-e:8090/query"
+	addr, err := serviceE.Addr(ctx)
+	if err != nil {
+		return "", &serviceEError{code: http.StatusServiceUnavailable, err: err}
+	}
+	url := "http://" + addr + "/query"
 
 	query := `
 		query {
@@ -125,15 +179,29 @@ func newGraphQLClient(ctx context.Context, tracer trace.Tracer) (string, error)
 		return "", err
 	}
 	request.Header.Set("Content-Type", "application/json")
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
-	response, err := http.DefaultClient.Do(request)
+	response, err := graphQLClient.Do(request)
 	if err != nil {
-		return "", err
+		code := http.StatusServiceUnavailable
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+			code = http.StatusGatewayTimeout
+		}
+		return "", &serviceEError{code: code, err: err}
 	}
 
+	defer response.Body.Close()
+
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return "", err
+		return "", &serviceEError{code: http.StatusServiceUnavailable, err: err}
+	}
+	if response.StatusCode != http.StatusOK {
+		code := http.StatusInternalServerError
+		switch response.StatusCode {
+		case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			code = response.StatusCode
+		}
+		return "", &serviceEError{code: code, err: fmt.Errorf("service-e returned %s: %s", response.Status, bytes.TrimSpace(body))}
 	}
 
 	return string(body), nil
@@ -7,7 +7,12 @@ package graph
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"service-e/graph/model"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // CreateTodo is the resolver for the createTodo field.
@@ -17,13 +22,17 @@ func (r *mutationResolver) CreateTodo(ctx context.Context, input model.NewTodo)
 
 // Todos is the resolver for the todos field.
 func (r *queryResolver) Todos(ctx context.Context) ([]*model.Todo, error) {
-	panic(fmt.Errorf("not implemented: Todos - todos"))
-	// return []*model.Todo{
-	// 	{
-	// 		ID:   "1",
-	// 		Text: "Hello, world!",
-	// 	},
-	// }, nil
+	// Requests from service-a's /start carry where the chain started.
+	origin := baggage.FromContext(ctx).Member("origin").Value()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("todos.origin", origin))
+	slog.DebugContext(ctx, "listing todos", "origin", origin)
+
+	todos := []*model.Todo{}
+	r.Mapx.Range(func(id, text string) bool {
+		todos = append(todos, &model.Todo{ID: id, Text: text, User: &model.User{}})
+		return true
+	})
+	return todos, nil
 }
 
 // Mutation returns MutationResolver implementation.
@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
-	"log"
+	"flag"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"service-e/graph"
 	"service-e/mapx"
+	"syscall"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/handler/extension"
@@ -18,13 +23,10 @@ import (
 	graphqlTracer "service-e/tracing"
 
 	"github.com/vektah/gqlparser/v2/ast"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/baggage"
+
+	"telemetry"
 )
 
 const defaultPort = "8090"
@@ -34,16 +36,18 @@ func main() {
 	if port == "" {
 		port = defaultPort
 	}
+	addr := flag.String("addr", ":"+port, "`address` to listen on")
+	flag.Parse()
+	_, port, _ = net.SplitHostPort(*addr)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	tp, err := initTracer()
+	shutdown, err := telemetry.Setup(ctx, telemetry.WithServiceName("service-e"))
 	if err != nil {
-		log.Fatalf("failed to initialize tracer: %v", err)
+		slog.Error("failed to initialize telemetry", "error", err)
+		os.Exit(1)
 	}
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Printf("Error shutting down tracer: %v", err)
-		}
-	}()
 
 	tracer := otel.Tracer("service-e")
 	m := new(mapx.Map[string, string])
@@ -65,41 +69,50 @@ func main() {
 	})
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", otelhttp.NewHandler(srv, "GraphQL"))
+	http.Handle("/query", telemetry.NewHTTPHandler(simulateFailure(srv), "GraphQL"))
 
-	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
-}
+	slog.Info("connect to http://localhost:"+port+"/ for GraphQL playground", "addr", *addr)
+	httpSrv := &http.Server{Addr: *addr, ReadHeaderTimeout: 5 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpSrv.ListenAndServe()
+	}()
 
-func initTracer() (*sdktrace.TracerProvider, error) {
-	exporter, err := otlptracegrpc.New(
-		context.Background(),
-		otlptracegrpc.WithEndpoint(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
-		otlptracegrpc.WithInsecure(),
-	)
-	if err != nil {
-		log.Fatalf("failed to initialize stdouttrace export pipeline: %v", err)
-		return nil, err
+	var failed bool
+	select {
+	case err := <-serveErr:
+		slog.Error("failed to serve", "error", err)
+		failed = true
+	case <-ctx.Done():
+		slog.Info("shutting down", "cause", context.Cause(ctx))
 	}
+	stop()
 
-	res, err := resource.New(
-		context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("service-e"),
-		),
-	)
-	if err != nil {
-		log.Fatalf("failed to create resource: %v", err)
-		return nil, err
+	drainCtx, cancel := context.WithTimeout(context.Background(), telemetry.ShutdownTimeout())
+	defer cancel()
+	if err := httpSrv.Shutdown(drainCtx); err != nil {
+		slog.Error("failed to drain http server", "error", err)
 	}
 
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
-
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	flushCtx, cancel := context.WithTimeout(context.Background(), telemetry.ShutdownTimeout())
+	defer cancel()
+	if err := shutdown(flushCtx); err != nil {
+		slog.Error("error shutting down telemetry", "error", err)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
 
-	return tp, nil
+// simulateFailure fails the requests that service-a's /start asked to fail
+// here.
+func simulateFailure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if baggage.FromContext(r.Context()).Member("chain.fail").Value() == "service-e" {
+			http.Error(w, "simulated failure in service-e", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
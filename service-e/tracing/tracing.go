@@ -3,20 +3,38 @@ package tracing
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
 func TracerMiddleware(tracer trace.Tracer) graphql.HandlerExtension {
-	return &interceptor{tracer: tracer}
+	// Las respuestas GraphQL con errores devuelven HTTP 200, así que
+	// http.server.request.duration no las cuenta como fallidas.
+	duration, err := otel.Meter("service-e/tracing").Float64Histogram(
+		"graphql.server.request.duration",
+		metric.WithDescription("Duration of GraphQL operations."),
+		metric.WithUnit("s"),
+		// Los buckets por defecto van de 0 a 10000, pensados para
+		// milisegundos: en segundos todo caería en el primero.
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return &interceptor{tracer: tracer, duration: duration}
 }
 
 type interceptor struct {
-	tracer trace.Tracer
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
 }
 
 func (i *interceptor) ExtensionName() string {
@@ -30,9 +48,11 @@ func (i *interceptor) Validate(schema graphql.ExecutableSchema) error {
 // InterceptResponse captura errores de toda la operación GraphQL
 func (i *interceptor) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
 	span := trace.SpanFromContext(ctx)
+	start := time.Now()
 
 	// Ejecutar la operación
 	response := next(ctx)
+	i.recordDuration(ctx, start, response)
 
 	// Si hay errores en la respuesta, marcar el span raíz como error
 	if response != nil && len(response.Errors) > 0 && span != nil && span.SpanContext().IsValid() {
@@ -51,7 +71,7 @@ func (i *interceptor) InterceptResponse(ctx context.Context, next graphql.Respon
 			}
 		}
 
-		log.Printf("GraphQL operation completed with errors: %v", response.Errors)
+		slog.ErrorContext(ctx, "GraphQL operation completed with errors", "errors", response.Errors.Error())
 	} else if span != nil && span.SpanContext().IsValid() {
 		// No hay errores
 		span.SetStatus(codes.Ok, "GraphQL operation completed successfully")
@@ -62,6 +82,30 @@ func (i *interceptor) InterceptResponse(ctx context.Context, next graphql.Respon
 	return response
 }
 
+// recordDuration registra la duración de la operación con su tipo, nombre y
+// si terminó con errores.
+func (i *interceptor) recordDuration(ctx context.Context, start time.Time, response *graphql.Response) {
+	if i.duration == nil {
+		return
+	}
+
+	attrs := []attribute.KeyValue{}
+	if graphql.HasOperationContext(ctx) {
+		opCtx := graphql.GetOperationContext(ctx)
+		if opCtx.OperationName != "" {
+			attrs = append(attrs, semconv.GraphqlOperationName(opCtx.OperationName))
+		}
+		if opCtx.Operation != nil {
+			attrs = append(attrs, semconv.GraphqlOperationTypeKey.String(string(opCtx.Operation.Operation)))
+		}
+	}
+	if response != nil && len(response.Errors) > 0 {
+		attrs = append(attrs, semconv.ErrorTypeKey.String("graphql_error"))
+	}
+
+	i.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+}
+
 type GraphQLArgsCarrier map[string]any
 
 func (c GraphQLArgsCarrier) Get(key string) string {
@@ -87,14 +131,14 @@ func (i *interceptor) InterceptField(ctx context.Context, next graphql.Resolver)
 	fieldCtx := graphql.GetFieldContext(ctx)
 	// get query or mutation name
 	query := fieldCtx.Field.Name
-	log.Printf("Intercepting Query >> %s", query)
+	slog.DebugContext(ctx, "intercepting field", "query", query)
 	spanName := fmt.Sprintf("graphql.%s", query)
 	ctx, span := i.tracer.Start(ctx, spanName)
 	defer span.End()
 
 	// Configurar atributos del span si es válido
 	if span != nil && span.SpanContext().IsValid() {
-		log.Printf("%s Span is valid", spanName)
+		slog.DebugContext(ctx, "span is valid", "span", spanName)
 		span.SetAttributes(attribute.String("graphql.query", query))
 		span.SetAttributes(attribute.String("graphql.args", fmt.Sprintf("%v", fieldCtx.Args)))
 		span.SetAttributes(attribute.String("graphql.object", fieldCtx.Object))
@@ -112,7 +156,7 @@ func (i *interceptor) InterceptField(ctx context.Context, next graphql.Resolver)
 				span.RecordError(err)
 				span.SetAttributes(attribute.Bool("graphql.error", true))
 
-				log.Printf("GraphQL resolver error: %v", err)
+				slog.ErrorContext(ctx, "GraphQL resolver error", "error", err)
 			} else {
 				// Marcar como exitoso
 				span.SetStatus(codes.Ok, "GraphQL resolver completed successfully")
@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+const defaultAdminAddr = ":9464"
+
+// adminServer is the listener for operational endpoints such as /metrics.
+// It is kept apart from the business ports so that scraping and debugging
+// never compete with, or get exposed alongside, the service API.
+type adminServer struct {
+	addr string
+	mux  *http.ServeMux
+	srv  *http.Server
+}
+
+func newAdminServer(addr string) *adminServer {
+	return &adminServer{addr: addr, mux: http.NewServeMux()}
+}
+
+// Handle registers an admin endpoint.
+func (a *adminServer) Handle(pattern string, h http.Handler) {
+	a.mux.Handle(pattern, h)
+}
+
+// start listens on the configured address, or on the default port. The
+// /debug pages are always served, so the listener always starts; services
+// sharing a machine need an ADMIN_ADDR each.
+func (a *adminServer) start() error {
+	addr := a.addr
+	if addr == "" {
+		addr = defaultAdminAddr
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		if a.addr == "" {
+			return fmt.Errorf("failed to listen on default admin address %s, set ADMIN_ADDR: %w", addr, err)
+		}
+		return fmt.Errorf("failed to listen on admin address %s: %w", addr, err)
+	}
+	slog.Info("admin listening", "addr", l.Addr().String())
+	a.srv = &http.Server{Handler: a.mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := a.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			otel.Handle(fmt.Errorf("admin server: %w", err))
+		}
+	}()
+	return nil
+}
+
+func (a *adminServer) shutdown(ctx context.Context) error {
+	if a.srv == nil {
+		return nil
+	}
+	return a.srv.Shutdown(ctx)
+}
@@ -0,0 +1,47 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestAdminRoutes checks that the Prometheus endpoint shares the admin
+// listener with the debug pages.
+func TestAdminRoutes(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "none")
+	t.Setenv("OTEL_METRICS_EXPORTER", "prometheus")
+	t.Setenv("OTEL_LOGS_EXPORTER", "none")
+	addr := freeLocalAddr(t)
+	shutdown, err := Setup(context.Background(), WithServiceName("test"), WithAdminAddr(addr), WithAdminToken("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	for path, want := range map[string]string{
+		"/metrics":         "otel_errors_total",
+		"/debug/telemetry": `"service": "test"`,
+		"/debug/tracez":    "tracez",
+		"/debug/rpcz":      "rpcz",
+		"/config":          "", // behind the admin token
+	} {
+		res, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if want == "" {
+			if res.StatusCode != http.StatusUnauthorized {
+				t.Errorf("GET %s = %d, want 401", path, res.StatusCode)
+			}
+			continue
+		}
+		if res.StatusCode != http.StatusOK || !strings.Contains(string(body), want) {
+			t.Errorf("GET %s = %d, want 200 with %q:\n%.500s", path, res.StatusCode, want, body)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Package baggageattr provides a span processor that copies selected W3C
+// baggage members onto every span started in the process.
+package baggageattr
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const defaultMaxValueLength = 128
+
+// Processor sets an attribute for each allowed baggage member found in the
+// parent context of a starting span. The attribute key is the baggage key,
+// so a search for tenant.id works on every hop of the chain.
+type Processor struct {
+	keys           map[string]struct{}
+	prefixes       []string
+	maxValueLength int
+}
+
+var _ sdktrace.SpanProcessor = (*Processor)(nil)
+
+// Option configures a Processor.
+type Option func(*Processor)
+
+// WithKeys allows baggage members with exactly these keys.
+func WithKeys(keys ...string) Option {
+	return func(p *Processor) {
+		for _, k := range keys {
+			p.keys[k] = struct{}{}
+		}
+	}
+}
+
+// WithPrefixes allows baggage members whose key starts with any prefix.
+func WithPrefixes(prefixes ...string) Option {
+	return func(p *Processor) {
+		p.prefixes = append(p.prefixes, prefixes...)
+	}
+}
+
+// WithMaxValueLength truncates copied values to n bytes. Values are kept
+// whole when n is not positive.
+func WithMaxValueLength(n int) Option {
+	return func(p *Processor) {
+		p.maxValueLength = n
+	}
+}
+
+// New returns a Processor. Without WithKeys or WithPrefixes it copies
+// nothing.
+func New(opts ...Option) *Processor {
+	p := &Processor{
+		keys:           make(map[string]struct{}),
+		maxValueLength: defaultMaxValueLength,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// OnStart copies the allowed members of the parent baggage onto s.
+func (p *Processor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	members := baggage.FromContext(parent).Members()
+	if len(members) == 0 {
+		return
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(members))
+	for _, m := range members {
+		if !p.allowed(m.Key()) {
+			continue
+		}
+		attrs = append(attrs, attribute.String(m.Key(), p.truncate(m.Value())))
+	}
+	if len(attrs) > 0 {
+		s.SetAttributes(attrs...)
+	}
+}
+
+func (p *Processor) allowed(key string) bool {
+	if _, ok := p.keys[key]; ok {
+		return true
+	}
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Processor) truncate(v string) string {
+	if p.maxValueLength <= 0 || len(v) <= p.maxValueLength {
+		return v
+	}
+	v = v[:p.maxValueLength]
+	// Do not leave half of a multi-byte rune behind.
+	for len(v) > 0 && !utf8.ValidString(v) {
+		v = v[:len(v)-1]
+	}
+	return v
+}
+
+// OnEnd does nothing.
+func (p *Processor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+// ForceFlush does nothing.
+func (p *Processor) ForceFlush(context.Context) error { return nil }
+
+// Shutdown does nothing.
+func (p *Processor) Shutdown(context.Context) error { return nil }
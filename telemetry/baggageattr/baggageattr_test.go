@@ -0,0 +1,125 @@
+package baggageattr
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// withBaggage returns ctx carrying the members given as key, value pairs.
+func withBaggage(t *testing.T, ctx context.Context, kv ...string) context.Context {
+	t.Helper()
+	bag := baggage.FromContext(ctx)
+	for i := 0; i < len(kv); i += 2 {
+		m, err := baggage.NewMemberRaw(kv[i], kv[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bag, err = bag.SetMember(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+func attrs(s sdktrace.ReadOnlySpan) map[string]string {
+	out := map[string]string{}
+	for _, kv := range s.Attributes() {
+		out[string(kv.Key)] = kv.Value.Emit()
+	}
+	return out
+}
+
+func TestProcessor(t *testing.T) {
+	long := strings.Repeat("a", 200)
+	tests := []struct {
+		name    string
+		opts    []Option
+		baggage []string
+		want    map[string]string
+	}{
+		{
+			name:    "allowlist",
+			opts:    []Option{WithKeys("tenant.id", "user.id")},
+			baggage: []string{"tenant.id", "acme", "user.id", "42", "session", "secret"},
+			want:    map[string]string{"tenant.id": "acme", "user.id": "42"},
+		},
+		{
+			name:    "nothing allowed",
+			baggage: []string{"tenant.id", "acme"},
+			want:    map[string]string{},
+		},
+		{
+			name:    "prefix",
+			opts:    []Option{WithPrefixes("loadgen.")},
+			baggage: []string{"loadgen.run_id", "r1", "loadgen.step", "2", "loadgenx", "no", "tenant.id", "acme"},
+			want:    map[string]string{"loadgen.run_id": "r1", "loadgen.step": "2"},
+		},
+		{
+			name:    "default limit",
+			opts:    []Option{WithKeys("k")},
+			baggage: []string{"k", long},
+			want:    map[string]string{"k": long[:defaultMaxValueLength]},
+		},
+		{
+			name:    "at the limit",
+			opts:    []Option{WithKeys("k", "short"), WithMaxValueLength(4)},
+			baggage: []string{"k", "abcdef", "short", "abcd"},
+			want:    map[string]string{"k": "abcd", "short": "abcd"},
+		},
+		{
+			name:    "multi-byte rune at the limit",
+			opts:    []Option{WithKeys("k"), WithMaxValueLength(4)},
+			baggage: []string{"k", "abcé"},
+			want:    map[string]string{"k": "abc"},
+		},
+		{
+			name:    "no limit",
+			opts:    []Option{WithKeys("k"), WithMaxValueLength(0)},
+			baggage: []string{"k", long},
+			want:    map[string]string{"k": long},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(New(tt.opts...)), sdktrace.WithSpanProcessor(rec))
+			ctx := withBaggage(t, context.Background(), tt.baggage...)
+			_, span := tp.Tracer("test").Start(ctx, "span")
+			span.End()
+			if got := attrs(rec.Ended()[0]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("attributes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaggageChangedAfterStart(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(New(WithKeys("tenant.id"))), sdktrace.WithSpanProcessor(rec))
+	tracer := tp.Tracer("test")
+
+	ctx, parent := tracer.Start(withBaggage(t, context.Background(), "tenant.id", "acme"), "parent")
+	// Members are copied when a span starts: a later change only shows on
+	// the spans started from the new baggage.
+	ctx = withBaggage(t, ctx, "tenant.id", "globex")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	parent.End()
+
+	got := map[string]attribute.Value{}
+	for _, s := range rec.Ended() {
+		for _, kv := range s.Attributes() {
+			got[s.Name()] = kv.Value
+		}
+	}
+	if got["parent"].AsString() != "acme" || got["child"].AsString() != "globex" {
+		t.Errorf("tenant.id on parent, child = %q, %q, want acme, globex", got["parent"].AsString(), got["child"].AsString())
+	}
+}
@@ -0,0 +1,195 @@
+package telemetry
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// containerDetector describes the container the process runs in:
+//
+//	container.id          from /proc/self/cgroup or, under cgroup v2 with a
+//	                      private cgroup namespace, /proc/self/mountinfo
+//	container.runtime     guessed from the same path (docker, containerd, ...)
+//	container.name        from CONTAINER_NAME
+//	container.image.name  from CONTAINER_IMAGE, e.g. "registry:5000/app:1.2"
+//	container.image.tags  the tag of CONTAINER_IMAGE, if any
+//
+// Outside a container it detects nothing.
+type containerDetector struct {
+	cgroupPath    string
+	mountinfoPath string
+	getenv        func(string) string
+}
+
+var _ resource.Detector = containerDetector{}
+
+func newContainerDetector() containerDetector {
+	return containerDetector{
+		cgroupPath:    "/proc/self/cgroup",
+		mountinfoPath: "/proc/self/mountinfo",
+		getenv:        os.Getenv,
+	}
+}
+
+// containerIDPattern matches the 64 hex digit IDs used by Docker, containerd,
+// CRI-O and Podman.
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// containerRuntimes maps path fragments to the runtime that creates them, as
+// in /system.slice/docker-<id>.scope or /kubepods/.../cri-containerd-<id>.
+var containerRuntimes = []struct{ fragment, runtime string }{
+	{"cri-containerd", "containerd"},
+	{"containerd", "containerd"},
+	{"crio", "cri-o"},
+	{"libpod", "podman"},
+	{"podman", "podman"},
+	{"docker", "docker"},
+}
+
+func (d containerDetector) Detect(context.Context) (*resource.Resource, error) {
+	var attrs []attribute.KeyValue
+
+	// An unreadable /proc still leaves the attributes from the environment.
+	id, runtime, err := d.containerID()
+	if err != nil {
+		err = fmt.Errorf("%w: container.id: %w", resource.ErrPartialResource, err)
+	}
+	if id != "" {
+		attrs = append(attrs, semconv.ContainerID(id))
+	}
+	if runtime != "" {
+		attrs = append(attrs, semconv.ContainerRuntime(runtime))
+	}
+	if name := strings.TrimSpace(d.getenv("CONTAINER_NAME")); name != "" {
+		attrs = append(attrs, semconv.ContainerName(name))
+	}
+	if image := strings.TrimSpace(d.getenv("CONTAINER_IMAGE")); image != "" {
+		name, tag := splitImage(image)
+		attrs = append(attrs, semconv.ContainerImageName(name))
+		if tag != "" {
+			attrs = append(attrs, semconv.ContainerImageTags(tag))
+		}
+	}
+
+	if len(attrs) == 0 {
+		return resource.Empty(), err
+	}
+	return resource.NewWithAttributes(semconv.SchemaURL, attrs...), err
+}
+
+// containerID looks for the ID in the cgroup paths first. With cgroup v2 and
+// a private cgroup namespace, Docker's default, the only path is "/", and
+// the ID is taken from the files Docker bind-mounts into the container.
+func (d containerDetector) containerID() (id, runtime string, err error) {
+	id, runtime, err = scanFile(d.cgroupPath, cgroupContainerID)
+	if id != "" || err != nil {
+		return id, runtime, err
+	}
+	return scanFile(d.mountinfoPath, mountinfoContainerID)
+}
+
+// scanFile returns the first container ID parse finds in a line of path. A
+// missing file means no container, not an error.
+func scanFile(path string, parse func(string) (string, string)) (string, string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for s.Scan() {
+		if id, runtime := parse(s.Text()); id != "" {
+			return id, runtime, nil
+		}
+	}
+	return "", "", s.Err()
+}
+
+// cgroupContainerID parses a /proc/self/cgroup line,
+// "hierarchy-ID:controllers:path", in the v1 or the v2 ("0::path") layout:
+//
+//	12:memory:/docker/<id>
+//	0::/system.slice/docker-<id>.scope
+//	0::/kubepods/burstable/pod<uid>/cri-containerd-<id>.scope
+func cgroupContainerID(line string) (string, string) {
+	parts := strings.SplitN(line, ":", 3)
+	if len(parts) != 3 {
+		return "", ""
+	}
+	path := parts[2]
+	// The container's own cgroup is the last path element carrying an ID.
+	base := path[strings.LastIndex(path, "/")+1:]
+	ids := containerIDPattern.FindAllString(base, -1)
+	if len(ids) == 0 {
+		return "", ""
+	}
+	return ids[len(ids)-1], runtimeFromPath(path)
+}
+
+// mountinfoContainerID parses a /proc/self/mountinfo line, looking at the
+// mounts of /etc/hostname, /etc/hosts and /etc/resolv.conf, whose source
+// lies in the runtime's directory for the container:
+//
+//	... /var/lib/docker/containers/<id>/hostname /etc/hostname rw,... - ext4 ...
+//	... /containers/storage/overlay-containers/<id>/userdata/hostname /etc/hostname ...
+func mountinfoContainerID(line string) (string, string) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return "", ""
+	}
+	root, mountPoint := fields[3], fields[4]
+	switch mountPoint {
+	case "/etc/hostname", "/etc/hosts", "/etc/resolv.conf":
+	default:
+		return "", ""
+	}
+	for _, marker := range []string{"/containers/", "/overlay-containers/"} {
+		i := strings.LastIndex(root, marker)
+		if i < 0 {
+			continue
+		}
+		rest := root[i+len(marker):]
+		if id, _, _ := strings.Cut(rest, "/"); len(id) == 64 && containerIDPattern.MatchString(id) {
+			return id, runtimeFromPath(root)
+		}
+	}
+	return "", ""
+}
+
+func runtimeFromPath(path string) string {
+	for _, r := range containerRuntimes {
+		if strings.Contains(path, r.fragment) {
+			return r.runtime
+		}
+	}
+	return ""
+}
+
+// splitImage splits an image reference into its name and tag. A digest
+// ("app@sha256:...") is kept in the name; a colon before the last slash
+// belongs to a registry port, not to a tag.
+func splitImage(image string) (name, tag string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || i < strings.LastIndex(image, "/") {
+		return image, ""
+	}
+	return image[:i], image[i+1:]
+}
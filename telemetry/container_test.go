@@ -0,0 +1,80 @@
+package telemetry
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestContainerDetector(t *testing.T) {
+	const (
+		dockerID     = "3b1e4f5a6c7d8e9f00112233445566778899aabbccddeeff0011223344556677"
+		containerdID = "9f8e7d6c5b4a39281706f5e4d3c2b1a0ffeeddccbbaa99887766554433221100"
+		mountinfoID  = "a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"
+	)
+	tests := []struct {
+		name      string
+		cgroup    string
+		mountinfo string
+		env       map[string]string
+		want      []attribute.KeyValue
+	}{
+		{
+			name:      "cgroup v1",
+			cgroup:    "cgroup-v1",
+			mountinfo: "mountinfo-v2",
+			want:      []attribute.KeyValue{semconv.ContainerID(dockerID), semconv.ContainerRuntime("docker")},
+		},
+		{
+			name:      "cgroup v2",
+			cgroup:    "cgroup-v2",
+			mountinfo: "mountinfo-v2",
+			want:      []attribute.KeyValue{semconv.ContainerID(containerdID), semconv.ContainerRuntime("containerd")},
+		},
+		{
+			name:      "cgroup v2 private namespace",
+			cgroup:    "cgroup-v2-private",
+			mountinfo: "mountinfo-v2",
+			env:       map[string]string{"CONTAINER_NAME": "service-a", "CONTAINER_IMAGE": "registry:5000/service-a:1.2"},
+			want: []attribute.KeyValue{
+				semconv.ContainerID(mountinfoID),
+				semconv.ContainerRuntime("docker"),
+				semconv.ContainerName("service-a"),
+				semconv.ContainerImageName("registry:5000/service-a"),
+				semconv.ContainerImageTags("1.2"),
+			},
+		},
+		{
+			name:      "host",
+			cgroup:    "cgroup-host",
+			mountinfo: "mountinfo-host",
+		},
+		{
+			name:      "no proc",
+			cgroup:    "missing",
+			mountinfo: "missing",
+			env:       map[string]string{"CONTAINER_IMAGE": "app@sha256:0123"},
+			want:      []attribute.KeyValue{semconv.ContainerImageName("app@sha256:0123")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := containerDetector{
+				cgroupPath:    filepath.Join("testdata", "container", tt.cgroup),
+				mountinfoPath: filepath.Join("testdata", "container", tt.mountinfo),
+				getenv:        func(key string) string { return tt.env[key] },
+			}
+			res, err := d.Detect(context.Background())
+			if err != nil {
+				t.Fatalf("Detect() error = %v", err)
+			}
+			want := attribute.NewSet(tt.want...)
+			if got := res.Set(); !got.Equals(&want) {
+				t.Errorf("Detect() = %v, want %v", got.Encoded(attribute.DefaultEncoder()), want.Encoded(attribute.DefaultEncoder()))
+			}
+		})
+	}
+}
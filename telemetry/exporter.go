@@ -0,0 +1,240 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+
+	"telemetry/spool"
+)
+
+const (
+	protocolGRPC         = "grpc"
+	protocolHTTPProtobuf = "http/protobuf"
+	protocolHTTPJSON     = "http/json"
+)
+
+// newTraceExporters builds one exporter per entry of OTEL_TRACES_EXPORTER
+// (default "otlp"). "none" yields no exporters at all.
+func newTraceExporters(ctx context.Context, cfg *config) ([]*countingExporter, error) {
+	var exporters []*countingExporter
+	for _, name := range envList("OTEL_TRACES_EXPORTER", "otlp") {
+		var (
+			exp sdktrace.SpanExporter
+			err error
+		)
+		switch name {
+		case "none":
+			continue
+		case "otlp":
+			exp, err = newOTLPTraceExporter(ctx, cfg)
+		case "console", "stdout":
+			exp, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+		case "zipkin":
+			exp, err = zipkin.New(os.Getenv("OTEL_EXPORTER_ZIPKIN_ENDPOINT"))
+		default:
+			err = fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s trace exporter: %w", name, err)
+		}
+		exporters = append(exporters, newCountingExporter(name, exp))
+	}
+	return exporters, nil
+}
+
+// newOTLPTraceExporter builds the OTLP trace exporter, behind an on-disk
+// spool when one is configured. The spool takes over from the client's own
+// retries so that batches leave the in-memory queue as soon as an upload
+// fails.
+func newOTLPTraceExporter(ctx context.Context, cfg *config) (sdktrace.SpanExporter, error) {
+	spoolDir, spoolOpts, err := spoolOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newOTLPTraceClient(spoolDir != "")
+	if err != nil {
+		return nil, err
+	}
+	if spoolDir != "" {
+		if client, err = spool.New(client, spoolDir, spoolOpts...); err != nil {
+			return nil, err
+		}
+	}
+	return otlptrace.New(ctx, client)
+}
+
+func newOTLPTraceClient(noRetry bool) (otlptrace.Client, error) {
+	protocol := envFirst(protocolGRPC, "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL")
+	s, err := newOTLPSettings("TRACES", "/v1/traces")
+	if err != nil {
+		return nil, err
+	}
+
+	switch protocol {
+	case protocolGRPC:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithHeaders(s.headers)}
+		if s.host != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(s.host))
+		}
+		if s.insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(s.tls)))
+		}
+		if s.gzip {
+			opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+		}
+		if s.timeout > 0 {
+			opts = append(opts, otlptracegrpc.WithTimeout(s.timeout))
+		}
+		if noRetry {
+			opts = append(opts, otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{Enabled: false}))
+		}
+		return otlptracegrpc.NewClient(opts...), nil
+	case protocolHTTPProtobuf:
+		opts := []otlptracehttp.Option{otlptracehttp.WithURLPath(s.path), otlptracehttp.WithHeaders(s.headers)}
+		if s.host != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(s.host))
+		}
+		if s.insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		} else {
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(s.tls))
+		}
+		if s.gzip {
+			opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+		}
+		if s.timeout > 0 {
+			opts = append(opts, otlptracehttp.WithTimeout(s.timeout))
+		}
+		if noRetry {
+			opts = append(opts, otlptracehttp.WithRetry(otlptracehttp.RetryConfig{Enabled: false}))
+		}
+		return otlptracehttp.NewClient(opts...), nil
+	case protocolHTTPJSON:
+		return newJSONTraceClient(s), nil
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", protocol)
+	}
+}
+
+// spoolOptions returns the spool directory and limits given through
+// WithTraceSpool or the environment. No directory means no spool.
+//
+//	OTEL_TRACES_SPOOL_DIR        directory of the write-ahead log
+//	OTEL_TRACES_SPOOL_MAX_BYTES  size cap in bytes, 64 MiB by default
+//	OTEL_TRACES_SPOOL_MAX_AGE    oldest batch still replayed, e.g. "6h"
+func spoolOptions(cfg *config) (string, []spool.Option, error) {
+	if cfg.spoolDir != "" {
+		return cfg.spoolDir, cfg.spool, nil
+	}
+	dir := os.Getenv("OTEL_TRACES_SPOOL_DIR")
+	if dir == "" {
+		return "", nil, nil
+	}
+
+	var opts []spool.Option
+	if v := os.Getenv("OTEL_TRACES_SPOOL_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid OTEL_TRACES_SPOOL_MAX_BYTES %q: %w", v, err)
+		}
+		opts = append(opts, spool.WithMaxBytes(n))
+	}
+	if v := os.Getenv("OTEL_TRACES_SPOOL_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid OTEL_TRACES_SPOOL_MAX_AGE %q: %w", v, err)
+		}
+		opts = append(opts, spool.WithMaxAge(d))
+	}
+	return dir, opts, nil
+}
+
+// endpoint is an OTLP endpoint split into the pieces the exporters accept.
+type endpoint struct {
+	host     string
+	path     string
+	insecure bool
+}
+
+// otlpEndpoint resolves the signal specific endpoint variable, falling back
+// to OTEL_EXPORTER_OTLP_ENDPOINT with signalPath appended. Bare host:port
+// values such as "jaeger:4317" are accepted and treated as plaintext.
+func otlpEndpoint(signalEnv, signalPath string) (endpoint, error) {
+	raw, path := os.Getenv(signalEnv), ""
+	if raw == "" {
+		raw, path = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), signalPath
+	}
+	if raw == "" {
+		return endpoint{path: signalPath, insecure: true}, nil
+	}
+	if !strings.Contains(raw, "://") {
+		return endpoint{host: raw, path: signalPath, insecure: true}, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return endpoint{}, fmt.Errorf("invalid OTLP endpoint %q: %w", raw, err)
+	}
+	if path == "" {
+		path = u.Path
+	} else {
+		path = strings.TrimSuffix(u.Path, "/") + path
+	}
+	if path == "" {
+		path = signalPath
+	}
+	return endpoint{host: u.Host, path: path, insecure: u.Scheme != "https"}, nil
+}
+
+func (e endpoint) url() string {
+	scheme := "https"
+	if e.insecure {
+		scheme = "http"
+	}
+	host := e.host
+	if host == "" {
+		host = "localhost:4318"
+	}
+	return scheme + "://" + host + e.path
+}
+
+// envList splits a comma separated environment variable into lower-cased,
+// trimmed entries.
+func envList(key, def string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		v = def
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// envFirst returns the first non-empty value among keys, or def.
+func envFirst(def string, keys ...string) string {
+	for _, key := range keys {
+		if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+			return v
+		}
+	}
+	return def
+}
@@ -0,0 +1,172 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"telemetry/spool"
+)
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// ShutdownTimeout is how long a service may spend draining its servers and,
+// separately, flushing telemetry once it has been asked to stop. It is read
+// from SHUTDOWN_TIMEOUT (e.g. "5s") and defaults to 10 seconds.
+func ShutdownTimeout() time.Duration {
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d > 0 {
+			return d
+		}
+		slog.Warn("invalid SHUTDOWN_TIMEOUT, using default", "value", v, "default", defaultShutdownTimeout)
+	}
+	return defaultShutdownTimeout
+}
+
+// exporterStats follows the spans handed to one exporter's batch processor,
+// so that shutdown can tell how many were exported and how many were lost,
+// and /debug/telemetry can show whether the exporter is keeping up.
+type exporterStats struct {
+	exporter string
+	capacity int64
+
+	queued   atomic.Int64 // accepted into the queue
+	pending  atomic.Int64 // accepted and not yet handed to the exporter
+	rejected atomic.Int64 // dropped because the queue was full
+	exported atomic.Int64
+	spooled  atomic.Int64 // spilled to the on-disk spool, replayed later
+	failed   atomic.Int64
+
+	duration metric.Float64Histogram
+
+	mu           sync.Mutex
+	lastExport   time.Time
+	lastDuration time.Duration
+	lastError    string
+	lastErrorAt  time.Time
+}
+
+// report logs the totals once the batch processor has been shut down. Spans
+// accepted but neither exported, spooled nor failed were still queued when
+// the processor gave up, usually because the flush timed out, and count as
+// dropped along with those rejected by a full queue. The totals are logged
+// whether or not the flush timed out.
+func (c *exporterStats) report(ctx context.Context) error {
+	exported, spooled, failed := c.exported.Load(), c.spooled.Load(), c.failed.Load()
+	dropped := c.rejected.Load() + c.queued.Load() - exported - spooled - failed
+
+	level := slog.LevelInfo
+	if failed > 0 || dropped > 0 {
+		level = slog.LevelWarn
+	}
+	slog.Log(ctx, level, "flushed spans",
+		"exporter", c.exporter,
+		"exported", exported,
+		"spooled", spooled,
+		"failed", failed,
+		"dropped", dropped,
+		"timed_out", ctx.Err() != nil,
+	)
+	return nil
+}
+
+func (c *exporterStats) recordExport(start time.Time, n int, err error) {
+	d := time.Since(start)
+	spooled := errors.Is(err, spool.ErrSpooled)
+	outcome := "exported"
+	switch {
+	case spooled:
+		outcome = "spooled"
+	case err != nil:
+		outcome = "failed"
+	}
+	c.duration.Record(context.Background(), d.Seconds(), metric.WithAttributes(
+		attribute.String("exporter", c.exporter),
+		attribute.String("outcome", outcome),
+	))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastExport, c.lastDuration = start, d
+	switch {
+	case spooled:
+		c.spooled.Add(int64(n))
+	case err != nil:
+		c.failed.Add(int64(n))
+		c.lastError, c.lastErrorAt = err.Error(), start
+	default:
+		c.exported.Add(int64(n))
+	}
+}
+
+// countingExporter records the outcome and latency of every export. A batch
+// spilled to the spool is counted apart and not reported as an error: the
+// spool delivers it later.
+type countingExporter struct {
+	sdktrace.SpanExporter
+	counts *exporterStats
+}
+
+func newCountingExporter(name string, exp sdktrace.SpanExporter) *countingExporter {
+	counts := &exporterStats{exporter: name, capacity: bspQueueSize()}
+	counts.duration, _ = otel.Meter("telemetry").Float64Histogram("otel.exporter.span.export.duration",
+		metric.WithDescription("Duration of span exports, by exporter and outcome."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30))
+	return &countingExporter{SpanExporter: exp, counts: counts}
+}
+
+func (e *countingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.counts.pending.Add(-int64(len(spans)))
+	start := time.Now()
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.counts.recordExport(start, len(spans), err)
+	if err != nil && !errors.Is(err, spool.ErrSpooled) {
+		return fmt.Errorf("%s exporter: %w", e.counts.exporter, err)
+	}
+	return nil
+}
+
+// countingProcessor records the sampled spans entering a batch processor.
+// The processor drops spans silently when its queue is full, so the queue
+// is bounded here instead, where the drop can be counted.
+type countingProcessor struct {
+	sdktrace.SpanProcessor
+	counts *exporterStats
+}
+
+func (p countingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	if p.counts.pending.Add(1) > p.counts.capacity {
+		p.counts.pending.Add(-1)
+		p.counts.rejected.Add(1)
+		return
+	}
+	p.counts.queued.Add(1)
+	p.SpanProcessor.OnEnd(s)
+}
+
+// bspQueueSize is the queue capacity the batch span processor reads from
+// OTEL_BSP_MAX_QUEUE_SIZE.
+func bspQueueSize() int64 {
+	if v := os.Getenv("OTEL_BSP_MAX_QUEUE_SIZE"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return sdktrace.DefaultMaxQueueSize
+}
@@ -0,0 +1,49 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"telemetry/spool"
+)
+
+// errExporter fails every export with err.
+type errExporter struct {
+	sdktrace.SpanExporter
+	err error
+}
+
+func (e errExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error { return e.err }
+
+func TestCountingExporterOutcomes(t *testing.T) {
+	spans := tracetest.SpanStubs{{Name: "a"}, {Name: "b"}}.Snapshots()
+	tests := []struct {
+		name                      string
+		err                       error
+		wantErr                   bool
+		exported, spooled, failed int64
+	}{
+		{name: "exported", exported: 2},
+		// otlptrace wraps the client's error.
+		{name: "spooled", err: fmt.Errorf("traces export: %w", spool.ErrSpooled), spooled: 2},
+		{name: "failed", err: fmt.Errorf("connection refused"), wantErr: true, failed: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := newCountingExporter("otlp", errExporter{err: tt.err})
+			err := exp.ExportSpans(context.Background(), spans)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExportSpans() = %v, want error %v", err, tt.wantErr)
+			}
+			c := exp.counts
+			if c.exported.Load() != tt.exported || c.spooled.Load() != tt.spooled || c.failed.Load() != tt.failed {
+				t.Errorf("exported, spooled, failed = %d, %d, %d, want %d, %d, %d",
+					c.exported.Load(), c.spooled.Load(), c.failed.Load(), tt.exported, tt.spooled, tt.failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/health" // client-side health checking
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+// grpcServiceConfig balances calls over every address the target resolves
+// to, skipping backends whose grpc.health.v1 service does not report
+// SERVING. Servers without the health service are treated as healthy.
+const grpcServiceConfig = `{
+	"loadBalancingConfig": [{"round_robin": {}}],
+	"healthCheckConfig": {"serviceName": ""}
+}`
+
+// grpcClientKeepalive pings idle connections so that a backend that went
+// away is noticed before the next call; servers must permit pings this
+// frequent, see GRPCServerKeepalive.
+var grpcClientKeepalive = keepalive.ClientParameters{
+	Time:                30 * time.Second,
+	Timeout:             10 * time.Second,
+	PermitWithoutStream: true,
+}
+
+var grpcConnectivityStates = []connectivity.State{
+	connectivity.Idle,
+	connectivity.Connecting,
+	connectivity.Ready,
+	connectivity.TransientFailure,
+	connectivity.Shutdown,
+}
+
+// NewGRPCClient returns a connection to target meant to live as long as the
+// process: it is instrumented with otelgrpc, keeps idle connections alive,
+// balances round-robin over the resolved addresses with health checking and
+// reports its connectivity state as the grpc.client.connection.state
+// metric. Every unary call, with the hops reported in its server-timing
+// trailer, is added to the Server-Timing of the request being served. It
+// starts connecting right away. opts are applied after the
+// defaults, so they can replace the plaintext credentials, for example.
+//
+// Close the connection on shutdown, after the servers calling it have been
+// drained.
+func NewGRPCClient(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// The health Watch stream lasts as long as the connection; it is
+		// not traced.
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))),
+		grpc.WithKeepaliveParams(grpcClientKeepalive),
+		grpc.WithDefaultServiceConfig(grpcServiceConfig),
+		grpc.WithChainUnaryInterceptor(hopInterceptor(hopName(target))),
+	}, opts...)
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc client for %s: %w", target, err)
+	}
+	if err := watchConnectivity(conn, target); err != nil {
+		otel.Handle(err)
+	}
+	conn.Connect()
+	return conn, nil
+}
+
+// watchConnectivity reports the state of conn, one series per state with
+// value 1 for the current one, and counts its transitions. It stops when
+// the connection is closed.
+func watchConnectivity(conn *grpc.ClientConn, target string) error {
+	meter := otel.Meter("telemetry")
+	transitions, err := meter.Int64Counter("grpc.client.connection.transitions",
+		metric.WithDescription("Connectivity state changes of long-lived gRPC client connections, by new state."),
+		metric.WithUnit("{transition}"))
+	if err != nil {
+		return err
+	}
+	targetAttr := attribute.String("grpc.target", target)
+	_, err = meter.Int64ObservableGauge("grpc.client.connection.state",
+		metric.WithDescription("1 for the current connectivity state of a long-lived gRPC client connection, 0 for the others."),
+		metric.WithUnit("{state}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			current := conn.GetState()
+			if current == connectivity.Shutdown {
+				return nil
+			}
+			for _, s := range grpcConnectivityStates {
+				var v int64
+				if s == current {
+					v = 1
+				}
+				o.Observe(v, metric.WithAttributes(targetAttr, attribute.String("grpc.connectivity.state", s.String())))
+			}
+			return nil
+		}))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		state := conn.GetState()
+		for conn.WaitForStateChange(context.Background(), state) {
+			state = conn.GetState()
+			transitions.Add(context.Background(), 1, metric.WithAttributes(
+				targetAttr,
+				attribute.String("grpc.connectivity.state", state.String()),
+			))
+			if state == connectivity.Shutdown {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// hopInterceptor records each call to service as a downstream hop.
+func hopInterceptor(service string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var trailer metadata.MD
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Trailer(&trailer))...)
+		recordHop(ctx, service, time.Since(start), trailer.Get("server-timing"))
+		return err
+	}
+}
@@ -0,0 +1,69 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+// GRPCServerKeepalive is the keepalive enforcement policy servers called
+// through NewGRPCClient must use. gRPC's default closes connections pinging
+// more often than every five minutes.
+var GRPCServerKeepalive = keepalive.EnforcementPolicy{
+	MinTime:             15 * time.Second,
+	PermitWithoutStream: true,
+}
+
+// NewGRPCServer returns a server instrumented with otelgrpc, health checks
+// left out, that accepts the keepalive pings of NewGRPCClient. Unary calls
+// answer with the traceresponse, x-trace-id and server-timing trailers, the
+// gRPC counterpart of the headers set by NewHTTPHandler. opts are applied
+// after the defaults.
+func NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		// The health Watch stream lasts as long as the connection; it is
+		// not traced.
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))),
+		grpc.KeepaliveEnforcementPolicy(GRPCServerKeepalive),
+		grpc.ChainUnaryInterceptor(traceTrailers),
+	}, opts...)
+	return grpc.NewServer(opts...)
+}
+
+// GracefulStop waits for the in-flight RPCs of s to finish and closes it
+// forcibly if they are still running when ctx expires.
+func GracefulStop(ctx context.Context, s *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("forcing grpc server stop", "error", ctx.Err())
+		s.Stop()
+	}
+}
+
+func traceTrailers(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx, st := withServerTiming(ctx)
+	res, err := handler(ctx, req)
+
+	md := metadata.Pairs("server-timing", st.header(time.Since(start)))
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		md.Set("traceresponse", traceResponse(sc))
+		md.Set("x-trace-id", sc.TraceID().String())
+	}
+	// Fails only if the call already ended, when there is no one to tell.
+	_ = grpc.SetTrailer(ctx, md)
+	return res, err
+}
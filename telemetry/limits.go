@@ -0,0 +1,98 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// defaultAttributeValueLengthLimit caps string attributes when no limit is
+// configured. The SDK default is unlimited, which lets a single large
+// GraphQL argument or error message inflate a span past what the collector
+// accepts.
+const defaultAttributeValueLengthLimit = 4096
+
+// spanLimits returns the limits read by the SDK from the OTEL_SPAN_*,
+// OTEL_EVENT_*, OTEL_LINK_* and OTEL_ATTRIBUTE_* variables, with a 4096
+// byte default for attribute values, overlaid with the non-zero fields of
+// the limits passed to WithSpanLimits.
+func spanLimits(cfg *config) sdktrace.SpanLimits {
+	limits := sdktrace.NewSpanLimits()
+	if os.Getenv("OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT") == "" && os.Getenv("OTEL_ATTRIBUTE_VALUE_LENGTH_LIMIT") == "" {
+		limits.AttributeValueLengthLimit = defaultAttributeValueLengthLimit
+	}
+	if cfg.spanLimits == nil {
+		return limits
+	}
+	overlay := func(dst *int, v int) {
+		if v != 0 {
+			*dst = v
+		}
+	}
+	overlay(&limits.AttributeValueLengthLimit, cfg.spanLimits.AttributeValueLengthLimit)
+	overlay(&limits.AttributeCountLimit, cfg.spanLimits.AttributeCountLimit)
+	overlay(&limits.EventCountLimit, cfg.spanLimits.EventCountLimit)
+	overlay(&limits.LinkCountLimit, cfg.spanLimits.LinkCountLimit)
+	overlay(&limits.AttributePerEventCountLimit, cfg.spanLimits.AttributePerEventCountLimit)
+	overlay(&limits.AttributePerLinkCountLimit, cfg.spanLimits.AttributePerLinkCountLimit)
+	return limits
+}
+
+// limitsProcessor counts what the span limits discarded, so that truncated
+// spans show up on dashboards instead of only in a missing attribute.
+type limitsProcessor struct {
+	dropped metric.Int64Counter
+}
+
+func newLimitsProcessor() *limitsProcessor {
+	p := &limitsProcessor{}
+	p.dropped, _ = otel.Meter("telemetry").Int64Counter("otel.span.limit.dropped",
+		metric.WithDescription("Attributes, events and links discarded from ended spans because of span limits."),
+		metric.WithUnit("{item}"))
+	return p
+}
+
+var (
+	droppedAttributes = metric.WithAttributes(attribute.String("type", "attribute"))
+	droppedEvents     = metric.WithAttributes(attribute.String("type", "event"))
+	droppedLinks      = metric.WithAttributes(attribute.String("type", "link"))
+	droppedEventAttrs = metric.WithAttributes(attribute.String("type", "event_attribute"))
+	droppedLinkAttrs  = metric.WithAttributes(attribute.String("type", "link_attribute"))
+)
+
+func (p *limitsProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *limitsProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	ctx := context.Background()
+	if n := s.DroppedAttributes(); n > 0 {
+		p.dropped.Add(ctx, int64(n), droppedAttributes)
+	}
+	if n := s.DroppedEvents(); n > 0 {
+		p.dropped.Add(ctx, int64(n), droppedEvents)
+	}
+	if n := s.DroppedLinks(); n > 0 {
+		p.dropped.Add(ctx, int64(n), droppedLinks)
+	}
+
+	var eventAttrs, linkAttrs int
+	for _, e := range s.Events() {
+		eventAttrs += e.DroppedAttributeCount
+	}
+	for _, l := range s.Links() {
+		linkAttrs += l.DroppedAttributeCount
+	}
+	if eventAttrs > 0 {
+		p.dropped.Add(ctx, int64(eventAttrs), droppedEventAttrs)
+	}
+	if linkAttrs > 0 {
+		p.dropped.Add(ctx, int64(linkAttrs), droppedLinkAttrs)
+	}
+}
+
+func (p *limitsProcessor) ForceFlush(context.Context) error { return nil }
+
+func (p *limitsProcessor) Shutdown(context.Context) error { return nil }
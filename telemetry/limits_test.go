@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestSpanLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		opts []Option
+		want sdktrace.SpanLimits
+	}{
+		{
+			name: "defaults",
+			want: limitsWith(func(l *sdktrace.SpanLimits) { l.AttributeValueLengthLimit = 4096 }),
+		},
+		{
+			name: "environment",
+			env: map[string]string{
+				"OTEL_ATTRIBUTE_VALUE_LENGTH_LIMIT": "-1",
+				"OTEL_SPAN_EVENT_COUNT_LIMIT":       "10",
+			},
+			want: limitsWith(func(l *sdktrace.SpanLimits) {
+				l.AttributeValueLengthLimit = -1
+				l.EventCountLimit = 10
+			}),
+		},
+		{
+			name: "option keeps unset fields",
+			env:  map[string]string{"OTEL_SPAN_LINK_COUNT_LIMIT": "5"},
+			opts: []Option{WithSpanLimits(sdktrace.SpanLimits{AttributeValueLengthLimit: 256})},
+			want: limitsWith(func(l *sdktrace.SpanLimits) {
+				l.AttributeValueLengthLimit = 256
+				l.LinkCountLimit = 5
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{
+				"OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT", "OTEL_ATTRIBUTE_VALUE_LENGTH_LIMIT",
+				"OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT", "OTEL_ATTRIBUTE_COUNT_LIMIT",
+				"OTEL_SPAN_EVENT_COUNT_LIMIT", "OTEL_SPAN_LINK_COUNT_LIMIT",
+				"OTEL_EVENT_ATTRIBUTE_COUNT_LIMIT", "OTEL_LINK_ATTRIBUTE_COUNT_LIMIT",
+			} {
+				t.Setenv(key, tt.env[key])
+			}
+			cfg := &config{}
+			for _, opt := range tt.opts {
+				opt(cfg)
+			}
+			if got := spanLimits(cfg); got != tt.want {
+				t.Errorf("spanLimits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func limitsWith(f func(*sdktrace.SpanLimits)) sdktrace.SpanLimits {
+	l := sdktrace.SpanLimits{
+		AttributeValueLengthLimit:   sdktrace.DefaultAttributeValueLengthLimit,
+		AttributeCountLimit:         sdktrace.DefaultAttributeCountLimit,
+		EventCountLimit:             sdktrace.DefaultEventCountLimit,
+		LinkCountLimit:              sdktrace.DefaultLinkCountLimit,
+		AttributePerEventCountLimit: sdktrace.DefaultAttributePerEventCountLimit,
+		AttributePerLinkCountLimit:  sdktrace.DefaultAttributePerLinkCountLimit,
+	}
+	f(&l)
+	return l
+}
@@ -0,0 +1,201 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+// logLevel is the minimum level of the default slog logger installed by
+// Setup, initialised from LOG_LEVEL.
+var logLevel slog.LevelVar
+
+// newLogProcessors builds a batch processor for each OTLP entry of
+// OTEL_LOGS_EXPORTER (default "otlp"). It also reports whether logs should
+// be written as JSON to stdout, which happens for "console" or "stdout",
+// whenever no OTLP exporter is configured and when OTLP has no endpoint set:
+// without a collector on the default address, stdout is the only place the
+// logs show up.
+func newLogProcessors(ctx context.Context) ([]sdklog.Processor, bool, error) {
+	var (
+		processors []sdklog.Processor
+		console    bool
+	)
+	for _, name := range envList("OTEL_LOGS_EXPORTER", "otlp") {
+		switch name {
+		case "none":
+		case "console", "stdout":
+			console = true
+		case "otlp":
+			exp, err := newOTLPLogExporter(ctx)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to create otlp log exporter: %w", err)
+			}
+			processors = append(processors, sdklog.NewBatchProcessor(exp))
+		default:
+			return nil, false, fmt.Errorf("unsupported OTEL_LOGS_EXPORTER %q", name)
+		}
+	}
+	noEndpoint := envFirst("", "OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT") == ""
+	return processors, console || len(processors) == 0 || noEndpoint, nil
+}
+
+func newOTLPLogExporter(ctx context.Context) (sdklog.Exporter, error) {
+	protocol := envFirst(protocolGRPC, "OTEL_EXPORTER_OTLP_LOGS_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL")
+	s, err := newOTLPSettings("LOGS", "/v1/logs")
+	if err != nil {
+		return nil, err
+	}
+
+	switch protocol {
+	case protocolGRPC:
+		opts := []otlploggrpc.Option{otlploggrpc.WithHeaders(s.headers)}
+		if s.host != "" {
+			opts = append(opts, otlploggrpc.WithEndpoint(s.host))
+		}
+		if s.insecure {
+			opts = append(opts, otlploggrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlploggrpc.WithTLSCredentials(credentials.NewTLS(s.tls)))
+		}
+		if s.gzip {
+			opts = append(opts, otlploggrpc.WithCompressor("gzip"))
+		}
+		if s.timeout > 0 {
+			opts = append(opts, otlploggrpc.WithTimeout(s.timeout))
+		}
+		return otlploggrpc.New(ctx, opts...)
+	case protocolHTTPJSON:
+		otel.Handle(fmt.Errorf("OTLP protocol %q is not supported for logs, using %q", protocol, protocolHTTPProtobuf))
+		fallthrough
+	case protocolHTTPProtobuf:
+		opts := []otlploghttp.Option{otlploghttp.WithURLPath(s.path), otlploghttp.WithHeaders(s.headers)}
+		if s.host != "" {
+			opts = append(opts, otlploghttp.WithEndpoint(s.host))
+		}
+		if s.insecure {
+			opts = append(opts, otlploghttp.WithInsecure())
+		} else {
+			opts = append(opts, otlploghttp.WithTLSClientConfig(s.tls))
+		}
+		if s.gzip {
+			opts = append(opts, otlploghttp.WithCompression(otlploghttp.GzipCompression))
+		}
+		if s.timeout > 0 {
+			opts = append(opts, otlploghttp.WithTimeout(s.timeout))
+		}
+		return otlploghttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", protocol)
+	}
+}
+
+// newLogHandler returns the handler behind the default slog logger: records
+// go to the LoggerProvider through the otelslog bridge when OTLP export is
+// enabled, and as JSON with trace_id and span_id to stdout when console is
+// set.
+func newLogHandler(name string, lp *sdklog.LoggerProvider, otlp, console bool) slog.Handler {
+	var handlers []slog.Handler
+	if otlp {
+		handlers = append(handlers, otelslog.NewHandler(name, otelslog.WithLoggerProvider(lp)))
+	}
+	if console {
+		handlers = append(handlers, traceContextHandler{slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})})
+	}
+	return &levelHandler{level: &logLevel, handlers: handlers}
+}
+
+func newFallbackLogHandler() slog.Handler {
+	return traceContextHandler{slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: &logLevel})}
+}
+
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: %w", s, err)
+	}
+	return level, nil
+}
+
+// levelHandler applies the shared minimum level and fans records out to
+// every configured handler.
+type levelHandler struct {
+	level    slog.Leveler
+	handlers []slog.Handler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	if l < h.level.Level() {
+		return false
+	}
+	for _, next := range h.handlers {
+		if next.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	for _, next := range h.handlers {
+		if next.Enabled(ctx, r.Level) {
+			err = errors.Join(err, next.Handle(ctx, r.Clone()))
+		}
+	}
+	return err
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := &levelHandler{level: h.level, handlers: make([]slog.Handler, len(h.handlers))}
+	for i, next := range h.handlers {
+		out.handlers[i] = next.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	out := &levelHandler{level: h.level, handlers: make([]slog.Handler, len(h.handlers))}
+	for i, next := range h.handlers {
+		out.handlers[i] = next.WithGroup(name)
+	}
+	return out
+}
+
+// traceContextHandler adds the trace_id and span_id of the span in the
+// record's context, so stdout logs can be joined with traces.
+type traceContextHandler struct {
+	slog.Handler
+}
+
+func (h traceContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceContextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceContextHandler) WithGroup(name string) slog.Handler {
+	return traceContextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,175 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"google.golang.org/grpc/credentials"
+)
+
+// newMetricReaders builds a reader for each entry of OTEL_METRICS_EXPORTER
+// (default "otlp"), each one also collecting from producers. Push exporters
+// use a periodic reader following OTEL_METRIC_EXPORT_INTERVAL; "prometheus"
+// is served as /metrics on the admin listener.
+func newMetricReaders(ctx context.Context, admin *adminServer, producers []sdkmetric.Producer) ([]sdkmetric.Reader, error) {
+	var readers []sdkmetric.Reader
+	for _, name := range envList("OTEL_METRICS_EXPORTER", "otlp") {
+		var (
+			exp sdkmetric.Exporter
+			err error
+		)
+		switch name {
+		case "none":
+			continue
+		case "prometheus":
+			reader, err := newPrometheusReader(admin, producers)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create prometheus metric exporter: %w", err)
+			}
+			readers = append(readers, reader)
+			continue
+		case "otlp":
+			exp, err = newOTLPMetricExporter(ctx)
+		case "console", "stdout":
+			exp, err = stdoutmetric.New(stdoutmetric.WithPrettyPrint())
+		default:
+			err = fmt.Errorf("unsupported OTEL_METRICS_EXPORTER %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s metric exporter: %w", name, err)
+		}
+		var opts []sdkmetric.PeriodicReaderOption
+		for _, p := range producers {
+			opts = append(opts, sdkmetric.WithProducer(p))
+		}
+		readers = append(readers, sdkmetric.NewPeriodicReader(exp, opts...))
+	}
+	return readers, nil
+}
+
+// exemplarFilterFromEnv reads OTEL_METRICS_EXEMPLAR_FILTER: "trace_based"
+// (default), "always_on" or "always_off".
+func exemplarFilterFromEnv() (exemplar.Filter, error) {
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_METRICS_EXEMPLAR_FILTER"))); v {
+	case "", "trace_based":
+		return exemplar.TraceBasedFilter, nil
+	case "always_on":
+		return exemplar.AlwaysOnFilter, nil
+	case "always_off":
+		return exemplar.AlwaysOffFilter, nil
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_METRICS_EXEMPLAR_FILTER %q", v)
+	}
+}
+
+func newPrometheusReader(admin *adminServer, producers []sdkmetric.Producer) (sdkmetric.Reader, error) {
+	reg := prometheus.NewRegistry()
+	opts := []otelprom.Option{otelprom.WithRegisterer(reg)}
+	for _, p := range producers {
+		opts = append(opts, otelprom.WithProducer(p))
+	}
+	exp, err := otelprom.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	// Exemplars are only part of the OpenMetrics format, which Prometheus
+	// negotiates through the Accept header.
+	admin.Handle("GET /metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+		ErrorLog:          promErrorLog{},
+		EnableOpenMetrics: true,
+	}))
+	return exp, nil
+}
+
+// promErrorLog forwards scrape errors to the OpenTelemetry error handler.
+type promErrorLog struct{}
+
+func (promErrorLog) Println(v ...any) {
+	otel.Handle(errors.New(fmt.Sprint(v...)))
+}
+
+func newOTLPMetricExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	protocol := envFirst(protocolGRPC, "OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL")
+	s, err := newOTLPSettings("METRICS", "/v1/metrics")
+	if err != nil {
+		return nil, err
+	}
+
+	switch protocol {
+	case protocolGRPC:
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithHeaders(s.headers)}
+		if s.host != "" {
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(s.host))
+		}
+		if s.insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(s.tls)))
+		}
+		if s.gzip {
+			opts = append(opts, otlpmetricgrpc.WithCompressor("gzip"))
+		}
+		if s.timeout > 0 {
+			opts = append(opts, otlpmetricgrpc.WithTimeout(s.timeout))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	case protocolHTTPJSON:
+		// The metric exporter only speaks protobuf over HTTP; collectors
+		// accepting JSON on /v1/metrics accept protobuf as well.
+		otel.Handle(fmt.Errorf("OTLP protocol %q is not supported for metrics, using %q", protocol, protocolHTTPProtobuf))
+		fallthrough
+	case protocolHTTPProtobuf:
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithURLPath(s.path), otlpmetrichttp.WithHeaders(s.headers)}
+		if s.host != "" {
+			opts = append(opts, otlpmetrichttp.WithEndpoint(s.host))
+		}
+		if s.insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		} else {
+			opts = append(opts, otlpmetrichttp.WithTLSClientConfig(s.tls))
+		}
+		if s.gzip {
+			opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+		}
+		if s.timeout > 0 {
+			opts = append(opts, otlpmetrichttp.WithTimeout(s.timeout))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", protocol)
+	}
+}
+
+// NewHTTPHandler wraps h with otelhttp so that it produces a server span and
+// the http.server.request.duration histogram. The histogram is labelled with
+// the http.route matched by http.ServeMux, which keeps /start, /hello and
+// /query apart on dashboards. Responses carry the traceresponse, X-Trace-Id
+// and Server-Timing headers; the latter lists the downstream hops made
+// through NewGRPCClient and NewHTTPTransport.
+func NewHTTPHandler(h http.Handler, operation string, opts ...otelhttp.Option) http.Handler {
+	opts = append([]otelhttp.Option{otelhttp.WithMetricAttributesFn(routeAttributes)}, opts...)
+	return otelhttp.NewHandler(traceHeaders(h), operation, opts...)
+}
+
+func routeAttributes(r *http.Request) []attribute.KeyValue {
+	if r.Pattern == "" {
+		return nil
+	}
+	return []attribute.KeyValue{semconv.HTTPRoute(r.Pattern)}
+}
@@ -0,0 +1,136 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sampledContext carries a sampled span context with a known trace ID.
+func sampledContext() context.Context {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c},
+		SpanID:     trace.SpanID{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31},
+		TraceFlags: trace.FlagsSampled,
+	})
+	return trace.ContextWithSpanContext(context.Background(), sc)
+}
+
+func TestExemplarFilterFromEnv(t *testing.T) {
+	tests := []struct {
+		env                 string
+		sampled, notSampled bool
+		wantErr             bool
+	}{
+		{env: "", sampled: true},
+		{env: "trace_based", sampled: true},
+		{env: " Trace_Based ", sampled: true},
+		{env: "always_on", sampled: true, notSampled: true},
+		{env: "always_off"},
+		{env: "sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("OTEL_METRICS_EXEMPLAR_FILTER", tt.env)
+		filter, err := exemplarFilterFromEnv()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: no error", tt.env)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.env, err)
+			continue
+		}
+		if got := filter(sampledContext()); got != tt.sampled {
+			t.Errorf("%q: exemplar for a sampled span = %v, want %v", tt.env, got, tt.sampled)
+		}
+		if got := filter(context.Background()); got != tt.notSampled {
+			t.Errorf("%q: exemplar without a sampled span = %v, want %v", tt.env, got, tt.notSampled)
+		}
+	}
+}
+
+func TestPrometheusExemplars(t *testing.T) {
+	t.Setenv("OTEL_METRICS_EXEMPLAR_FILTER", "")
+	admin := newAdminServer("")
+	reader, err := newPrometheusReader(admin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := exemplarFilterFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithExemplarFilter(filter))
+	defer mp.Shutdown(context.Background())
+
+	h, err := mp.Meter("test").Float64Histogram("request.duration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Record(sampledContext(), 0.2)
+
+	scrape := func(accept string) string {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		admin.mux.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	const exemplar = `trace_id="0af7651916cd43dd8448eb211c80319c"`
+	if body := scrape("application/openmetrics-text; version=1.0.0"); !strings.Contains(body, exemplar) {
+		t.Errorf("OpenMetrics scrape has no exemplar %s:\n%s", exemplar, body)
+	}
+	// The Prometheus text format has no exemplars.
+	if body := scrape(""); !strings.Contains(body, "request_duration") || strings.Contains(body, "trace_id") {
+		t.Errorf("text scrape:\n%s", body)
+	}
+}
+
+func TestHTTPHandlerRouteMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})
+	mux := http.NewServeMux()
+	mux.Handle("/start", NewHTTPHandler(ok, "StartHandler"))
+	mux.Handle("GET /items/{id}", NewHTTPHandler(ok, "ItemHandler"))
+	for _, path := range []string{"/start", "/start", "/items/1", "/items/2", "/items/3"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]uint64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "http.server.request.duration" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+				route, _ := dp.Attributes.Value(semconv.HTTPRouteKey)
+				got[route.AsString()] += dp.Count
+			}
+		}
+	}
+	// A request per path would make a series per item.
+	if want := map[string]uint64{"/start": 2, "GET /items/{id}": 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("http.server.request.duration counts by http.route = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,196 @@
+package telemetry
+
+import (
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"telemetry/baggageattr"
+	"telemetry/spool"
+	"telemetry/tailsampling"
+)
+
+type config struct {
+	serviceName    string
+	serviceVersion string
+	environment    string
+	resourceAttrs  []attribute.KeyValue
+	sampler        sdktrace.Sampler
+	spanLimits     *sdktrace.SpanLimits
+	tailSampling   []tailsampling.Option
+	baggageAttrs   []baggageattr.Option
+	spoolDir       string
+	spool          []spool.Option
+	adminAddr      string
+	adminToken     string
+	configFile     string
+	exemplarFilter exemplar.Filter
+	runtimeMetrics *bool
+	traceOpts      []sdktrace.TracerProviderOption
+	meterOpts      []sdkmetric.Option
+	loggerOpts     []sdklog.LoggerProviderOption
+}
+
+// Option configures Setup.
+type Option func(*config)
+
+// WithServiceName sets the service.name resource attribute.
+func WithServiceName(name string) Option {
+	return func(c *config) {
+		c.serviceName = name
+	}
+}
+
+// WithServiceVersion sets service.version. By default it is taken from the
+// build information embedded in the binary.
+func WithServiceVersion(version string) Option {
+	return func(c *config) {
+		c.serviceVersion = version
+	}
+}
+
+// WithDeploymentEnvironment sets deployment.environment, "development" by
+// default.
+func WithDeploymentEnvironment(env string) Option {
+	return func(c *config) {
+		c.environment = env
+	}
+}
+
+// WithResourceAttributes adds attributes to the resource shared by every
+// provider.
+func WithResourceAttributes(attrs ...attribute.KeyValue) Option {
+	return func(c *config) {
+		c.resourceAttrs = append(c.resourceAttrs, attrs...)
+	}
+}
+
+// WithSampler sets the sampler of the TracerProvider, overriding
+// OTEL_TRACES_SAMPLER.
+func WithSampler(s sdktrace.Sampler) Option {
+	return func(c *config) {
+		c.sampler = s
+	}
+}
+
+// WithSpanLimits sets the attribute, event and link limits of every span,
+// overriding the OTEL_SPAN_*_LIMIT variables. Zero fields keep the limit
+// from the environment or its default; negative ones mean unlimited.
+func WithSpanLimits(limits sdktrace.SpanLimits) Option {
+	return func(c *config) {
+		c.spanLimits = &limits
+	}
+}
+
+// WithTailSampling puts a tail sampling processor in front of the exporters.
+// Without options it keeps traces with errors and drops the rest; see
+// tailsampling.WithPolicies and tailsampling.WithSamplingRatio.
+func WithTailSampling(opts ...tailsampling.Option) Option {
+	return func(c *config) {
+		c.tailSampling = append([]tailsampling.Option{}, opts...)
+	}
+}
+
+// WithTraceSpool keeps OTLP span batches in dir while the collector is
+// unreachable and replays them when it is back, overriding
+// OTEL_TRACES_SPOOL_DIR. See package spool for the limits.
+func WithTraceSpool(dir string, opts ...spool.Option) Option {
+	return func(c *config) {
+		c.spoolDir = dir
+		c.spool = append([]spool.Option{}, opts...)
+	}
+}
+
+// WithBaggageAttributes copies the baggage members selected by opts onto
+// every span, overriding OTEL_BAGGAGE_SPAN_ATTRIBUTES.
+func WithBaggageAttributes(opts ...baggageattr.Option) Option {
+	return func(c *config) {
+		c.baggageAttrs = append([]baggageattr.Option{}, opts...)
+	}
+}
+
+// WithAdminAddr sets the address of the admin listener serving /metrics
+// and the /debug pages, overriding ADMIN_ADDR. It defaults to :9464.
+func WithAdminAddr(addr string) Option {
+	return func(c *config) {
+		c.adminAddr = addr
+	}
+}
+
+// WithAdminToken enables GET and PUT /config on the admin listener, which
+// read and change the sampler and log level at runtime, and sets the bearer
+// token they require. It overrides ADMIN_TOKEN; without a token the
+// endpoint is not served.
+func WithAdminToken(token string) Option {
+	return func(c *config) {
+		c.adminToken = token
+	}
+}
+
+// WithConfigFile sets a JSON file holding the sampler and log level, applied
+// at startup and again whenever it changes. It overrides
+// TELEMETRY_CONFIG_FILE.
+func WithConfigFile(path string) Option {
+	return func(c *config) {
+		c.configFile = path
+	}
+}
+
+// WithExemplarFilter selects which measurements may become exemplars,
+// overriding OTEL_METRICS_EXEMPLAR_FILTER. The default,
+// exemplar.TraceBasedFilter, only keeps measurements made within a sampled
+// span, so every exemplar links to a trace that was exported.
+func WithExemplarFilter(f exemplar.Filter) Option {
+	return func(c *config) {
+		c.exemplarFilter = f
+	}
+}
+
+// WithRuntimeMetrics turns the Go runtime and process metrics on or off,
+// overriding OTEL_RUNTIME_METRICS. They are on by default.
+func WithRuntimeMetrics(enabled bool) Option {
+	return func(c *config) {
+		c.runtimeMetrics = &enabled
+	}
+}
+
+// WithTracerProviderOptions passes extra options to the TracerProvider, for
+// example additional span processors.
+func WithTracerProviderOptions(opts ...sdktrace.TracerProviderOption) Option {
+	return func(c *config) {
+		c.traceOpts = append(c.traceOpts, opts...)
+	}
+}
+
+// WithMeterProviderOptions passes extra options to the MeterProvider, for
+// example additional readers or views.
+func WithMeterProviderOptions(opts ...sdkmetric.Option) Option {
+	return func(c *config) {
+		c.meterOpts = append(c.meterOpts, opts...)
+	}
+}
+
+// WithLoggerProviderOptions passes extra options to the LoggerProvider, for
+// example additional log processors.
+func WithLoggerProviderOptions(opts ...sdklog.LoggerProviderOption) Option {
+	return func(c *config) {
+		c.loggerOpts = append(c.loggerOpts, opts...)
+	}
+}
+
+func newConfig(opts ...Option) *config {
+	c := &config{
+		environment: defaultEnvironment,
+		adminAddr:   os.Getenv("ADMIN_ADDR"),
+		adminToken:  os.Getenv("ADMIN_TOKEN"),
+		configFile:  os.Getenv("TELEMETRY_CONFIG_FILE"),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
@@ -0,0 +1,272 @@
+package telemetry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+// otlpSettings are the connection settings of one OTLP exporter. Every value
+// is read from OTEL_EXPORTER_OTLP_<SIGNAL>_<NAME>, falling back to
+// OTEL_EXPORTER_OTLP_<NAME>:
+//
+//	ENDPOINT            collector address, see otlpEndpoint
+//	INSECURE            "true" for plaintext, "false" to force TLS on a bare host:port
+//	CERTIFICATE         PEM bundle of the CAs trusted for the collector
+//	CLIENT_CERTIFICATE  PEM client certificate for mTLS
+//	CLIENT_KEY          PEM key of the client certificate
+//	HEADERS             "key=value,..." sent with every export, values URL-encoded
+//	COMPRESSION         "gzip" or "none"
+//	TIMEOUT             export timeout in milliseconds
+//
+// Certificate files are re-read when they change on disk, so rotating them
+// does not need a restart.
+type otlpSettings struct {
+	endpoint
+	headers map[string]string
+	gzip    bool
+	timeout time.Duration
+	tls     *tls.Config
+}
+
+func newOTLPSettings(signal, signalPath string) (otlpSettings, error) {
+	// lookup returns the value of the first variable set and its name, to
+	// report the one that was actually read.
+	lookup := func(name string) (key, value string) {
+		for _, key := range []string{"OTEL_EXPORTER_OTLP_" + signal + "_" + name, "OTEL_EXPORTER_OTLP_" + name} {
+			if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+				return key, v
+			}
+		}
+		return "", ""
+	}
+	env := func(name string) string {
+		_, v := lookup(name)
+		return v
+	}
+
+	ep, err := otlpEndpoint("OTEL_EXPORTER_OTLP_"+signal+"_ENDPOINT", signalPath)
+	if err != nil {
+		return otlpSettings{}, err
+	}
+	s := otlpSettings{endpoint: ep}
+
+	caFile, certFile, keyFile := env("CERTIFICATE"), env("CLIENT_CERTIFICATE"), env("CLIENT_KEY")
+	if key, v := lookup("INSECURE"); v != "" {
+		insecure, err := strconv.ParseBool(v)
+		if err != nil {
+			return otlpSettings{}, fmt.Errorf("invalid %s %q: %w", key, v, err)
+		}
+		s.insecure = insecure
+	} else if caFile != "" || certFile != "" {
+		// Configuring certificates implies TLS, even for "collector:4317".
+		s.insecure = false
+	}
+	if !s.insecure {
+		if s.tls, err = newReloadingTLSConfig(serverName(ep.host), caFile, certFile, keyFile); err != nil {
+			return otlpSettings{}, err
+		}
+	}
+
+	if s.headers, err = parseHeaders(env("HEADERS")); err != nil {
+		return otlpSettings{}, err
+	}
+
+	switch v := strings.ToLower(env("COMPRESSION")); v {
+	case "", "none":
+	case "gzip":
+		s.gzip = true
+	default:
+		return otlpSettings{}, fmt.Errorf("unsupported OTLP compression %q", v)
+	}
+
+	if v := env("TIMEOUT"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return otlpSettings{}, fmt.Errorf("invalid OTLP timeout %q: want milliseconds", v)
+		}
+		s.timeout = time.Duration(ms) * time.Millisecond
+	}
+	return s, nil
+}
+
+// parseHeaders parses the W3C baggage-like "key=value" list used by
+// OTEL_EXPORTER_OTLP_HEADERS, e.g. "api-key=secret,authorization=Bearer%20t".
+func parseHeaders(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	headers := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q: want key=value", entry)
+		}
+		v, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP header %q: %w", key, err)
+		}
+		headers[key] = v
+	}
+	return headers, nil
+}
+
+// serverName returns the host the collector certificate must be valid for:
+// the host of the endpoint, or localhost, the exporters' default.
+func serverName(hostport string) string {
+	if hostport == "" {
+		return "localhost"
+	}
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
+
+// newReloadingTLSConfig returns a client TLS configuration whose CA bundle
+// and client certificate follow the files on disk, for a collector at host.
+// Without caFile the system roots are used; without certFile no client
+// certificate is sent.
+func newReloadingTLSConfig(host, caFile, certFile, keyFile string) (*tls.Config, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("OTLP client certificate and key must be configured together")
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" && certFile == "" {
+		return cfg, nil
+	}
+
+	r := &certReloader{host: host, caFile: caFile, certFile: certFile, keyFile: keyFile}
+	// Fail at startup rather than on the first export.
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	if caFile != "" {
+		// RootCAs is fixed once the config is in use, so verification is
+		// done by hand against the current pool.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = r.verify
+	}
+	if certFile != "" {
+		cfg.GetClientCertificate = r.clientCertificate
+	}
+	return cfg, nil
+}
+
+// certReloader caches the parsed certificate files and re-reads them when
+// the modification time or size of any of them changes, checked at most once
+// per handshake. A rotation may well go back in time: cp -p and a symlink
+// swap both keep the mtime the new file had before.
+type certReloader struct {
+	// host is the collector host, verified against the certificate's DNS
+	// or IP names. The connection state cannot tell: TLS sends no server
+	// name for an IP address.
+	host                      string
+	caFile, certFile, keyFile string
+
+	mu     sync.Mutex
+	stamps [3]fileStamp
+	roots  *x509.CertPool
+	cert   *tls.Certificate
+}
+
+// fileStamp tells a version of a file from the next without reading it.
+// Neither field alone is enough: mtimes may have a resolution of a second
+// or go back in time, and a new version may well have the same size.
+type fileStamp struct {
+	modTime int64
+	size    int64
+}
+
+func stampOf(fi os.FileInfo) fileStamp {
+	return fileStamp{modTime: fi.ModTime().UnixNano(), size: fi.Size()}
+}
+
+func (r *certReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stamps [3]fileStamp
+	for i, name := range []string{r.caFile, r.certFile, r.keyFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return fmt.Errorf("failed to read OTLP certificate: %w", err)
+		}
+		stamps[i] = stampOf(fi)
+	}
+	if stamps == r.stamps {
+		return nil
+	}
+
+	var roots *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read OTLP CA bundle: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in OTLP CA bundle %s", r.caFile)
+		}
+	}
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load OTLP client certificate: %w", err)
+		}
+		cert = &c
+	}
+	r.roots, r.cert, r.stamps = roots, cert, stamps
+	return nil
+}
+
+// current reloads the files if they changed. A broken rotation (a key
+// written before its certificate, say) keeps the previous material.
+func (r *certReloader) current() (*x509.CertPool, *tls.Certificate) {
+	if err := r.reload(); err != nil {
+		otel.Handle(err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.roots, r.cert
+}
+
+func (r *certReloader) verify(cs tls.ConnectionState) error {
+	roots, _ := r.current()
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("collector presented no certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       r.host,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+func (r *certReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	_, cert := r.current()
+	return cert, nil
+}
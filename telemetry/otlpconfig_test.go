@@ -0,0 +1,452 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestOTLPTLS exports to a collector stand-in reached by IP address that
+// requires a client certificate, then rotates the CA, the collector's
+// certificate and the client certificate without recreating the exporter.
+func TestOTLPTLS(t *testing.T) {
+	for _, protocol := range []string{protocolGRPC, protocolHTTPProtobuf} {
+		t.Run(protocol, func(t *testing.T) {
+			dir := t.TempDir()
+			caFile := filepath.Join(dir, "ca.pem")
+			certFile := filepath.Join(dir, "client.pem")
+			keyFile := filepath.Join(dir, "client-key.pem")
+
+			clientCA := newTestCA(t, "client CA")
+			serverCA := newTestCA(t, "collector CA 1")
+			writeFile(t, caFile, serverCA.certPEM)
+			clientCA.issue(t, "client-1", certFile, keyFile)
+
+			addr := freeLocalAddr(t)
+			c := startTestCollector(t, protocol, addr, serverCA.serverCert(t), clientCA.pool())
+
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "https://"+addr)
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", protocol)
+			t.Setenv("OTEL_EXPORTER_OTLP_CERTIFICATE", caFile)
+			t.Setenv("OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE", certFile)
+			t.Setenv("OTEL_EXPORTER_OTLP_CLIENT_KEY", keyFile)
+			t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret,authorization=Bearer%20token")
+			t.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "2000")
+
+			client, err := newOTLPTraceClient(true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			if err := client.Start(ctx); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = client.Stop(ctx) })
+
+			if err := upload(ctx, client); err != nil {
+				t.Fatalf("export failed: %v", err)
+			}
+			got := c.last()
+			if got.clientName != "client-1" {
+				t.Errorf("collector saw client certificate %q, want client-1", got.clientName)
+			}
+			if got.apiKey != "secret" || got.authorization != "Bearer token" {
+				t.Errorf("collector saw headers api-key=%q authorization=%q", got.apiKey, got.authorization)
+			}
+
+			// The collector moves to a certificate of a CA the exporter does
+			// not trust yet.
+			c.stop()
+			serverCA = newTestCA(t, "collector CA 2")
+			c = startTestCollector(t, protocol, addr, serverCA.serverCert(t), clientCA.pool())
+			if err := upload(ctx, client); err == nil {
+				t.Fatal("export to a collector with an untrusted certificate succeeded")
+			}
+			if n := c.count(); n != 0 {
+				t.Fatalf("untrusted collector received %d exports", n)
+			}
+
+			// Rotate the CA bundle and the client certificate on disk.
+			writeFile(t, caFile, serverCA.certPEM)
+			clientCA.issue(t, "client-2", certFile, keyFile)
+			later := time.Now().Add(time.Hour)
+			for _, name := range []string{caFile, certFile, keyFile} {
+				if err := os.Chtimes(name, later, later); err != nil {
+					t.Fatal(err)
+				}
+			}
+			deadline := time.Now().Add(15 * time.Second)
+			for err := upload(ctx, client); err != nil; err = upload(ctx, client) {
+				if time.Now().After(deadline) {
+					t.Fatalf("export after rotation failed: %v", err)
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+			if got := c.last().clientName; got != "client-2" {
+				t.Errorf("collector saw client certificate %q after rotation, want client-2", got)
+			}
+		})
+	}
+}
+
+// TestCertRotationOlderModTime rotates the files to versions older than the
+// ones loaded, as cp -p or a symlink swap to a previously written directory
+// does.
+func TestCertRotationOlderModTime(t *testing.T) {
+	tests := []struct {
+		name string
+		// rotate writes the new files, dir/..data links to current.
+		rotate func(t *testing.T, dir, current string, ca, client *testCA)
+	}{
+		{"copy keeping mtime", func(t *testing.T, _, current string, ca, client *testCA) {
+			writeFile(t, filepath.Join(current, "ca.pem"), ca.certPEM)
+			client.issue(t, "client-2", filepath.Join(current, "client.pem"), filepath.Join(current, "client-key.pem"))
+			setModTime(t, time.Now().Add(-time.Hour), current, "ca.pem", "client.pem", "client-key.pem")
+		}},
+		{"symlink swap", func(t *testing.T, dir, _ string, ca, client *testCA) {
+			// Like a mounted Kubernetes secret: the files link through
+			// ..data, which is swapped for a new directory.
+			next := filepath.Join(dir, "..2")
+			if err := os.Mkdir(next, 0o700); err != nil {
+				t.Fatal(err)
+			}
+			writeFile(t, filepath.Join(next, "ca.pem"), ca.certPEM)
+			client.issue(t, "client-2", filepath.Join(next, "client.pem"), filepath.Join(next, "client-key.pem"))
+			setModTime(t, time.Now().Add(-time.Hour), next, "ca.pem", "client.pem", "client-key.pem")
+			if err := os.Symlink("..2", filepath.Join(dir, "..data.tmp")); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(filepath.Join(dir, "..data.tmp"), filepath.Join(dir, "..data")); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			first := filepath.Join(dir, "..1")
+			if err := os.Mkdir(first, 0o700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink("..1", filepath.Join(dir, "..data")); err != nil {
+				t.Fatal(err)
+			}
+			files := filepath.Join(dir, "files")
+			if err := os.Mkdir(files, 0o700); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"ca.pem", "client.pem", "client-key.pem"} {
+				if err := os.Symlink(filepath.Join("..", "..data", name), filepath.Join(files, name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			oldCA, newCA, clientCA := newTestCA(t, "collector CA 1"), newTestCA(t, "collector CA 2"), newTestCA(t, "client CA")
+			writeFile(t, filepath.Join(first, "ca.pem"), oldCA.certPEM)
+			clientCA.issue(t, "client-1", filepath.Join(first, "client.pem"), filepath.Join(first, "client-key.pem"))
+
+			r := &certReloader{
+				caFile:   filepath.Join(files, "ca.pem"),
+				certFile: filepath.Join(files, "client.pem"),
+				keyFile:  filepath.Join(files, "client-key.pem"),
+			}
+			if roots, cert := r.current(); !roots.Equal(oldCA.pool()) || clientName(t, cert) != "client-1" {
+				t.Fatal("first load did not read the files")
+			}
+
+			tt.rotate(t, dir, first, newCA, clientCA)
+			roots, cert := r.current()
+			if !roots.Equal(newCA.pool()) {
+				t.Error("CA bundle not reloaded after rotation")
+			}
+			if got := clientName(t, cert); got != "client-2" {
+				t.Errorf("client certificate %q after rotation, want client-2", got)
+			}
+		})
+	}
+}
+
+func setModTime(t *testing.T, mtime time.Time, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func clientName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	if cert == nil {
+		return ""
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestInvalidInsecure(t *testing.T) {
+	for _, key := range []string{"OTEL_EXPORTER_OTLP_INSECURE", "OTEL_EXPORTER_OTLP_TRACES_INSECURE"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, "maybe")
+			_, err := newOTLPSettings("TRACES", "/v1/traces")
+			if err == nil || !strings.Contains(err.Error(), key+` "maybe"`) {
+				t.Errorf("newOTLPSettings() = %v, want an error naming %s", err, key)
+			}
+		})
+	}
+}
+
+func TestServerName(t *testing.T) {
+	for hostport, want := range map[string]string{
+		"":                 "localhost",
+		"127.0.0.1:4317":   "127.0.0.1",
+		"[::1]:4317":       "::1",
+		"collector:4318":   "collector",
+		"collector.local":  "collector.local",
+		"10.0.0.12:4317":   "10.0.0.12",
+		"otel.example.com": "otel.example.com",
+	} {
+		if got := serverName(hostport); got != want {
+			t.Errorf("serverName(%q) = %q, want %q", hostport, got, want)
+		}
+	}
+}
+
+func upload(ctx context.Context, client interface {
+	UploadTraces(context.Context, []*tracepb.ResourceSpans) error
+}) error {
+	return client.UploadTraces(ctx, []*tracepb.ResourceSpans{{}})
+}
+
+// export is what the collector stand-in saw of one export.
+type export struct {
+	clientName    string
+	apiKey        string
+	authorization string
+}
+
+// testCollector accepts OTLP trace exports over gRPC or HTTP, with mTLS.
+type testCollector struct {
+	coltracepb.UnimplementedTraceServiceServer
+
+	mu      sync.Mutex
+	exports []export
+	stop    func()
+}
+
+func startTestCollector(t *testing.T, protocol, addr string, cert tls.Certificate, clientCAs *x509.CertPool) *testCollector {
+	t.Helper()
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}
+	c := &testCollector{}
+	switch protocol {
+	case protocolGRPC:
+		srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+		coltracepb.RegisterTraceServiceServer(srv, c)
+		go func() { _ = srv.Serve(lis) }()
+		c.stop = srv.Stop
+	default:
+		srv := &http.Server{Handler: c, TLSConfig: tlsConfig, ReadHeaderTimeout: time.Second}
+		go func() { _ = srv.ServeTLS(lis, "", "") }()
+		c.stop = func() { _ = srv.Close() }
+	}
+	t.Cleanup(c.stop)
+	return c
+}
+
+func (c *testCollector) Export(ctx context.Context, _ *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	e := export{apiKey: first(md.Get("api-key")), authorization: first(md.Get("authorization"))}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			e.clientName = info.State.PeerCertificates[0].Subject.CommonName
+		}
+	}
+	c.record(e)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func (c *testCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if err := proto.Unmarshal(body, &coltracepb.ExportTraceServiceRequest{}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e := export{apiKey: r.Header.Get("api-key"), authorization: r.Header.Get("authorization")}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		e.clientName = r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	c.record(e)
+	res, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(res)
+}
+
+func (c *testCollector) record(e export) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exports = append(c.exports, e)
+}
+
+func (c *testCollector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.exports)
+}
+
+func (c *testCollector) last() export {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.exports) == 0 {
+		return export{}
+	}
+	return c.exports[len(c.exports)-1]
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// testCA is a certificate authority issuing test certificates.
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key := newKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	p := x509.NewCertPool()
+	p.AddCert(ca.cert)
+	return p
+}
+
+// serverCert issues a certificate for a collector reached as 127.0.0.1,
+// which has no DNS name and so no server name in the TLS handshake.
+func (ca *testCA) serverCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key := newKey(t)
+	der := ca.sign(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "collector"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, key)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// issue writes a client certificate named name and its key as PEM files.
+func (ca *testCA) issue(t *testing.T, name, certFile, keyFile string) {
+	t.Helper()
+	key := newKey(t)
+	der := ca.sign(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, key)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+}
+
+func (ca *testCA) sign(t *testing.T, tmpl *x509.Certificate, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = serial
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func freeLocalAddr(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
@@ -0,0 +1,147 @@
+package telemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// defaultOTLPTimeout matches the export timeout of the OTLP exporters.
+const defaultOTLPTimeout = 10 * time.Second
+
+// jsonTraceClient is an otlptrace.Client speaking OTLP/HTTP with JSON
+// payloads, which otlptracehttp does not support.
+type jsonTraceClient struct {
+	url     string
+	headers map[string]string
+	gzip    bool
+	client  *http.Client
+}
+
+func newJSONTraceClient(s otlpSettings) *jsonTraceClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = s.tls
+	timeout := s.timeout
+	if timeout == 0 {
+		timeout = defaultOTLPTimeout
+	}
+	return &jsonTraceClient{
+		url:     s.url(),
+		headers: s.headers,
+		gzip:    s.gzip,
+		client:  &http.Client{Transport: transport, Timeout: timeout},
+	}
+}
+
+func (c *jsonTraceClient) Start(context.Context) error { return nil }
+
+func (c *jsonTraceClient) Stop(context.Context) error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func (c *jsonTraceClient) UploadTraces(ctx context.Context, spans []*tracepb.ResourceSpans) error {
+	body, err := marshalTracesJSON(&coltracepb.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+
+	if c.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &httpStatusError{status: res.Status, code: res.StatusCode}
+	}
+	return nil
+}
+
+// httpStatusError is a non-2xx response to an export. The spool tells
+// retryable responses apart by their status code.
+type httpStatusError struct {
+	status string
+	code   int
+}
+
+func (e *httpStatusError) Error() string {
+	return "otlp http/json export failed: " + e.status
+}
+
+func (e *httpStatusError) HTTPStatusCode() int { return e.code }
+
+// marshalTracesJSON encodes req following the OTLP/JSON rules: enums are
+// integers, and trace and span IDs are hex where protojson would write
+// bytes fields as base64.
+func marshalTracesJSON(req *coltracepb.ExportTraceServiceRequest) ([]byte, error) {
+	raw, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	hexIDs(doc)
+	return json.Marshal(doc)
+}
+
+func hexIDs(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, val := range v {
+			switch key {
+			case "traceId", "spanId", "parentSpanId":
+				if s, ok := val.(string); ok {
+					if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+						v[key] = hex.EncodeToString(b)
+					}
+				}
+			default:
+				hexIDs(val)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			hexIDs(item)
+		}
+	}
+}
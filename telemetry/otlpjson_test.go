@@ -0,0 +1,61 @@
+package telemetry
+
+import (
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestMarshalTracesJSON(t *testing.T) {
+	traceID := []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c}
+	req := &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Scope: &commonpb.InstrumentationScope{Name: "test"},
+				Spans: []*tracepb.Span{{
+					TraceId:           traceID,
+					SpanId:            []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74},
+					ParentSpanId:      []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x73},
+					Name:              "GET /start",
+					Kind:              tracepb.Span_SPAN_KIND_SERVER,
+					StartTimeUnixNano: 1544712660000000000,
+					EndTimeUnixNano:   1544712661000000000,
+					Attributes: []*commonpb.KeyValue{{
+						Key:   "http.response.status_code",
+						Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 500}},
+					}},
+					Links: []*tracepb.Span_Link{{
+						TraceId: traceID,
+						SpanId:  []byte{0, 0, 0, 0, 0, 0, 0, 0x2a},
+					}},
+					Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "failed"},
+				}},
+			}},
+		}},
+	}
+
+	// IDs are lowercase hex, enums integers, and 64-bit integers, the
+	// timestamps included, strings.
+	const want = `{"resourceSpans":[{"scopeSpans":[{"scope":{"name":"test"},"spans":[{` +
+		`"attributes":[{"key":"http.response.status_code","value":{"intValue":"500"}}],` +
+		`"endTimeUnixNano":"1544712661000000000",` +
+		`"kind":2,` +
+		`"links":[{"spanId":"000000000000002a","traceId":"5b8efff798038103d269b633813fc60c"}],` +
+		`"name":"GET /start",` +
+		`"parentSpanId":"eee19b7ec3c1b173",` +
+		`"spanId":"eee19b7ec3c1b174",` +
+		`"startTimeUnixNano":"1544712660000000000",` +
+		`"status":{"code":2,"message":"failed"},` +
+		`"traceId":"5b8efff798038103d269b633813fc60c"` +
+		`}]}]}]}`
+
+	got, err := marshalTracesJSON(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("marshalTracesJSON() =\n%s\nwant\n%s", got, want)
+	}
+}
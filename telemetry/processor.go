@@ -0,0 +1,40 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// fanout forwards every span to several processors, so that wrappers such as
+// the tail sampler can sit in front of more than one exporter.
+type fanout []sdktrace.SpanProcessor
+
+func (f fanout) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	for _, p := range f {
+		p.OnStart(parent, s)
+	}
+}
+
+func (f fanout) OnEnd(s sdktrace.ReadOnlySpan) {
+	for _, p := range f {
+		p.OnEnd(s)
+	}
+}
+
+func (f fanout) ForceFlush(ctx context.Context) error {
+	var err error
+	for _, p := range f {
+		err = errors.Join(err, p.ForceFlush(ctx))
+	}
+	return err
+}
+
+func (f fanout) Shutdown(ctx context.Context) error {
+	var err error
+	for _, p := range f {
+		err = errors.Join(err, p.Shutdown(ctx))
+	}
+	return err
+}
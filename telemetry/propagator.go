@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+
+	"telemetry/baggageattr"
+)
+
+// propagatorFromEnv builds a composite of the propagators listed in
+// OTEL_PROPAGATORS, defaulting to W3C trace context and baggage. A
+// propagator listed twice is used once.
+func propagatorFromEnv() (propagation.TextMapPropagator, error) {
+	var props []propagation.TextMapPropagator
+	seen := map[string]bool{}
+	for _, name := range envList("OTEL_PROPAGATORS", "tracecontext,baggage") {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		switch name {
+		case "none":
+			continue
+		case "tracecontext":
+			props = append(props, propagation.TraceContext{})
+		case "baggage":
+			props = append(props, propagation.Baggage{})
+		case "b3":
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case "b3multi":
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "jaeger":
+			props = append(props, jaeger.Jaeger{})
+		default:
+			return nil, fmt.Errorf("unsupported OTEL_PROPAGATORS entry %q", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(props...), nil
+}
+
+// baggageAttributeOptions returns the baggage members to copy onto spans,
+// given through WithBaggageAttributes or OTEL_BAGGAGE_SPAN_ATTRIBUTES, a
+// comma separated list of keys where a trailing "*" marks a prefix:
+//
+//	OTEL_BAGGAGE_SPAN_ATTRIBUTES=tenant.id,user.id,experiment,loadgen.*
+//	OTEL_BAGGAGE_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT=64
+func baggageAttributeOptions(cfg *config) ([]baggageattr.Option, error) {
+	if cfg.baggageAttrs != nil {
+		return cfg.baggageAttrs, nil
+	}
+
+	var opts []baggageattr.Option
+	for _, key := range strings.Split(os.Getenv("OTEL_BAGGAGE_SPAN_ATTRIBUTES"), ",") {
+		key = strings.TrimSpace(key)
+		switch {
+		case key == "":
+		case strings.HasSuffix(key, "*"):
+			opts = append(opts, baggageattr.WithPrefixes(strings.TrimSuffix(key, "*")))
+		default:
+			opts = append(opts, baggageattr.WithKeys(key))
+		}
+	}
+	if len(opts) == 0 {
+		return nil, nil
+	}
+
+	if v := os.Getenv("OTEL_BAGGAGE_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTEL_BAGGAGE_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT %q: %w", v, err)
+		}
+		opts = append(opts, baggageattr.WithMaxValueLength(n))
+	}
+	return opts, nil
+}
@@ -0,0 +1,70 @@
+package telemetry
+
+import (
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// countingCarrier counts how often each header is set.
+type countingCarrier struct {
+	propagation.MapCarrier
+	sets map[string]int
+}
+
+func (c countingCarrier) Set(key, value string) {
+	c.sets[key]++
+	c.MapCarrier.Set(key, value)
+}
+
+func TestPropagatorFromEnv(t *testing.T) {
+	tests := []struct {
+		env     string
+		want    []string // headers injected
+		wantErr bool
+	}{
+		{env: "", want: []string{"baggage", "traceparent"}},
+		{env: "tracecontext,baggage", want: []string{"baggage", "traceparent"}},
+		{env: "b3", want: []string{"b3"}},
+		{env: "b3multi", want: []string{"x-b3-sampled", "x-b3-spanid", "x-b3-traceid"}},
+		{env: "jaeger", want: []string{"uber-trace-id"}},
+		{env: " TraceContext , B3 ", want: []string{"b3", "traceparent"}},
+		{env: "tracecontext,tracecontext,baggage,baggage", want: []string{"baggage", "traceparent"}},
+		{env: "none"},
+		{env: "none,tracecontext", want: []string{"traceparent"}},
+		{env: "tracecontext,xray", wantErr: true},
+	}
+
+	m, _ := baggage.NewMember("tenant.id", "acme")
+	bag, _ := baggage.New(m)
+	ctx := baggage.ContextWithBaggage(sampledContext(), bag)
+	for _, tt := range tests {
+		t.Setenv("OTEL_PROPAGATORS", tt.env)
+		prop, err := propagatorFromEnv()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: no error", tt.env)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.env, err)
+			continue
+		}
+
+		carrier := countingCarrier{MapCarrier: propagation.MapCarrier{}, sets: map[string]int{}}
+		prop.Inject(ctx, carrier)
+		got := carrier.Keys()
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: injected %v, want %v", tt.env, got, tt.want)
+		}
+		for key, n := range carrier.sets {
+			if n > 1 {
+				t.Errorf("%q: %s set %d times", tt.env, key, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// reconfigureSpanName is the span recording each configuration change.
+	// It is always sampled, whatever the sampler it installs.
+	reconfigureSpanName = "telemetry.reconfigure"
+
+	configPollInterval = 5 * time.Second
+	maxConfigBytes     = 64 << 10
+)
+
+// forceSampleKey marks the context of a span that dynamicSampler samples
+// whatever the current sampler. Unlike a span name, a context value cannot
+// be set by a client.
+type forceSampleKey struct{}
+
+// dynamicSampler delegates to a sampler that can be replaced while spans are
+// being started.
+type dynamicSampler struct {
+	current atomic.Pointer[samplerState]
+}
+
+// samplerState is a sampler with the OTEL_TRACES_SAMPLER name and argument
+// it was built from. The name is empty for a sampler given in code.
+type samplerState struct {
+	name, arg string
+	sampler   sdktrace.Sampler
+}
+
+func newDynamicSampler(name, arg string, s sdktrace.Sampler) *dynamicSampler {
+	d := &dynamicSampler{}
+	d.current.Store(&samplerState{name: name, arg: arg, sampler: s})
+	return d
+}
+
+// initialSampler returns the sampler given through WithSampler or, failing
+// that, OTEL_TRACES_SAMPLER, ready to be replaced at runtime.
+func initialSampler(cfg *config) (*dynamicSampler, error) {
+	if cfg.sampler != nil {
+		return newDynamicSampler("", "", cfg.sampler), nil
+	}
+	s, err := samplerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(envFirst("parentbased_always_on", "OTEL_TRACES_SAMPLER"))
+	return newDynamicSampler(name, os.Getenv("OTEL_TRACES_SAMPLER_ARG"), s), nil
+}
+
+func (d *dynamicSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if p.ParentContext != nil && p.ParentContext.Value(forceSampleKey{}) != nil {
+		psc := trace.SpanContextFromContext(p.ParentContext)
+		return sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample, Tracestate: psc.TraceState()}
+	}
+	return d.current.Load().sampler.ShouldSample(p)
+}
+
+func (d *dynamicSampler) Description() string {
+	return d.current.Load().sampler.Description()
+}
+
+// runtimeConfig is the part of the configuration that can change while the
+// service runs, as accepted by PUT /config and the watched config file.
+// Empty fields are left unchanged; a sampler_arg alone changes the argument
+// of the current sampler.
+type runtimeConfig struct {
+	Sampler    string `json:"sampler,omitempty"`
+	SamplerArg string `json:"sampler_arg,omitempty"`
+	LogLevel   string `json:"log_level,omitempty"`
+}
+
+type runtimeConfigJSON struct {
+	Sampler            string `json:"sampler,omitempty"`
+	SamplerArg         string `json:"sampler_arg,omitempty"`
+	SamplerDescription string `json:"sampler_description"`
+	LogLevel           string `json:"log_level"`
+}
+
+// reconfigurer applies runtime configuration changes coming from the admin
+// API or from the config file, logging each one and recording it as an
+// event of a telemetry.reconfigure span.
+type reconfigurer struct {
+	sampler  *dynamicSampler
+	token    string
+	file     string
+	interval time.Duration
+
+	mu    sync.Mutex // serialises changes
+	stamp fileStamp
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newReconfigurer(cfg *config, sampler *dynamicSampler) *reconfigurer {
+	return &reconfigurer{sampler: sampler, token: cfg.adminToken, file: cfg.configFile, interval: configPollInterval}
+}
+
+func (r *reconfigurer) apply(ctx context.Context, source string, c runtimeConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cur := r.sampler.current.Load()
+	next := cur
+	if c.Sampler != "" || c.SamplerArg != "" {
+		name := strings.ToLower(strings.TrimSpace(c.Sampler))
+		if name == "" {
+			if cur.name == "" {
+				return errors.New("the sampler was set in code: give a sampler name along with sampler_arg")
+			}
+			name = cur.name
+		}
+		s, err := newSampler(name, c.SamplerArg)
+		if err != nil {
+			return err
+		}
+		next = &samplerState{name: name, arg: strings.TrimSpace(c.SamplerArg), sampler: s}
+	}
+
+	oldLevel, level := logLevel.Level(), logLevel.Level()
+	if c.LogLevel != "" {
+		var err error
+		if level, err = parseLogLevel(c.LogLevel); err != nil {
+			return err
+		}
+	}
+
+	samplerChanged := next.sampler.Description() != cur.sampler.Description()
+	if !samplerChanged && level == oldLevel {
+		return nil
+	}
+
+	// Changes are logged at warn, so that they are seen whatever the level
+	// before or after them.
+	ctx, span := otel.Tracer("telemetry").Start(context.WithValue(ctx, forceSampleKey{}, true), reconfigureSpanName,
+		trace.WithAttributes(attribute.String("telemetry.config.source", source)))
+	defer span.End()
+
+	if samplerChanged {
+		r.sampler.current.Store(next)
+		span.AddEvent("sampler changed", trace.WithAttributes(
+			attribute.String("sampler.old", cur.sampler.Description()),
+			attribute.String("sampler.new", next.sampler.Description()),
+		))
+		slog.WarnContext(ctx, "sampler changed", "source", source,
+			"old", cur.sampler.Description(), "new", next.sampler.Description())
+	}
+	if level != oldLevel {
+		logLevel.Set(level)
+		span.AddEvent("log level changed", trace.WithAttributes(
+			attribute.String("log.level.old", oldLevel.String()),
+			attribute.String("log.level.new", level.String()),
+		))
+		slog.WarnContext(ctx, "log level changed", "source", source,
+			"old", oldLevel.String(), "new", level.String())
+	}
+	return nil
+}
+
+func (r *reconfigurer) snapshot() runtimeConfigJSON {
+	cur := r.sampler.current.Load()
+	return runtimeConfigJSON{
+		Sampler:            cur.name,
+		SamplerArg:         cur.arg,
+		SamplerDescription: cur.sampler.Description(),
+		LogLevel:           strings.ToLower(logLevel.Level().String()),
+	}
+}
+
+// ServeHTTP serves GET /config and PUT /config. Both require the admin
+// token as a bearer token.
+func (r *reconfigurer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !r.authorized(req) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if req.Method == http.MethodPut {
+		var c runtimeConfig
+		dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxConfigBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			http.Error(w, fmt.Sprintf("invalid configuration: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := r.apply(req.Context(), "admin", c); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(r.snapshot())
+}
+
+func (r *reconfigurer) authorized(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(r.token)) == 1
+}
+
+// start applies the config file, if any, and polls it for changes. A file
+// that cannot be applied at startup fails Setup; later errors are reported
+// and the previous configuration stays.
+func (r *reconfigurer) start(ctx context.Context) error {
+	if r.file == "" {
+		return nil
+	}
+	if err := r.load(ctx); err != nil {
+		return err
+	}
+	r.stop, r.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if err := r.load(context.Background()); err != nil {
+					otel.Handle(err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// load applies the config file when its modification time or size changed.
+func (r *reconfigurer) load(ctx context.Context) error {
+	fi, err := os.Stat(r.file)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if stampOf(fi) == r.stamp {
+		return nil
+	}
+	data, err := os.ReadFile(r.file)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	// Remember the version even if it is broken, so that it is reported
+	// once rather than on every poll.
+	r.stamp = stampOf(fi)
+
+	var c runtimeConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", r.file, err)
+	}
+	if err := r.apply(ctx, "file", c); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", r.file, err)
+	}
+	return nil
+}
+
+func (r *reconfigurer) shutdown(context.Context) error {
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+		r.stop = nil
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestReconfigurer returns a reconfigurer over an always_on sampler at
+// info level, with the spans of the global tracer provider recorded.
+func newTestReconfigurer(t *testing.T) (*reconfigurer, *tracetest.SpanRecorder) {
+	t.Helper()
+	level := logLevel.Level()
+	logLevel.Set(slog.LevelInfo)
+	t.Cleanup(func() { logLevel.Set(level) })
+
+	sampler := newDynamicSampler("always_on", "", sdktrace.AlwaysSample())
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler), sdktrace.WithSpanProcessor(rec))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	return newReconfigurer(&config{adminToken: "secret"}, sampler), rec
+}
+
+func sampled(s sdktrace.Sampler, name string) bool {
+	p := sdktrace.SamplingParameters{ParentContext: context.Background(), TraceID: trace.TraceID{1}, Name: name}
+	return s.ShouldSample(p).Decision == sdktrace.RecordAndSample
+}
+
+func putConfig(r *reconfigurer, auth, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(body))
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestConfigUnauthorized(t *testing.T) {
+	r, _ := newTestReconfigurer(t)
+	for _, auth := range []string{"", "Bearer wrong", "secret", "Basic c2VjcmV0"} {
+		w := putConfig(r, auth, `{"sampler":"always_off"}`)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("PUT /config with %q = %d, want 401", auth, w.Code)
+		}
+	}
+	if !sampled(r.sampler, "span") {
+		t.Error("unauthorized PUT /config changed the sampler")
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	r, _ := newTestReconfigurer(t)
+	for _, body := range []string{
+		`{"sampler":"bogus"}`,
+		`{"sampler":"traceidratio","sampler_arg":"2"}`,
+		`{"sampler":"always_off","log_level":"loud"}`,
+		`{"sampler":"always_off","color":"red"}`,
+		`not json`,
+	} {
+		w := putConfig(r, "Bearer secret", body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("PUT /config %s = %d, want 400", body, w.Code)
+		}
+	}
+	if got := r.sampler.Description(); got != "AlwaysOnSampler" {
+		t.Errorf("sampler = %s after invalid changes, want AlwaysOnSampler", got)
+	}
+	if got := logLevel.Level(); got != slog.LevelInfo {
+		t.Errorf("log level = %s after invalid changes, want INFO", got)
+	}
+}
+
+func TestConfigApplied(t *testing.T) {
+	r, rec := newTestReconfigurer(t)
+	w := putConfig(r, "Bearer secret", `{"sampler":"always_off","log_level":"debug"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT /config = %d: %s", w.Code, w.Body)
+	}
+	var got runtimeConfigJSON
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Sampler != "always_off" || got.LogLevel != "debug" {
+		t.Errorf("PUT /config returned %+v", got)
+	}
+
+	if sampled(r.sampler, "span") {
+		t.Error("span sampled after switching to always_off")
+	}
+	if level := logLevel.Level(); level != slog.LevelDebug {
+		t.Errorf("log level = %s, want DEBUG", level)
+	}
+
+	// The change itself is recorded, whatever the new sampler says, but
+	// the span name alone does not get a span past it.
+	spans := rec.Ended()
+	if len(spans) != 1 || spans[0].Name() != reconfigureSpanName || !spans[0].SpanContext().IsSampled() {
+		t.Fatalf("recorded spans %v, want one sampled %s", spans, reconfigureSpanName)
+	}
+	if sampled(r.sampler, reconfigureSpanName) {
+		t.Errorf("a %s span started outside the reconfigurer was sampled", reconfigureSpanName)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	r, _ := newTestReconfigurer(t)
+	r.file = filepath.Join(t.TempDir(), "config.json")
+	r.interval = 10 * time.Millisecond
+
+	write := func(body string, age time.Duration) {
+		t.Helper()
+		if err := os.WriteFile(r.file, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// Tell the versions apart whatever the file system's timestamp
+		// resolution.
+		mtime := time.Now().Add(age)
+		if err := os.Chtimes(r.file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitLevel := func(want slog.Level) {
+		t.Helper()
+		if !waitUntil(time.Second, func() bool { return logLevel.Level() == want }) {
+			t.Fatalf("log level = %s, want %s", logLevel.Level(), want)
+		}
+	}
+
+	write(`{"log_level":"warn"}`, -time.Hour)
+	if err := r.start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer r.shutdown(context.Background())
+	waitLevel(slog.LevelWarn)
+
+	write(`{"log_level":"error","sampler":"always_off"}`, 0)
+	waitLevel(slog.LevelError)
+	if sampled(r.sampler, "span") {
+		t.Error("span sampled after the file switched to always_off")
+	}
+
+	// A broken edit is reported and the previous configuration stays.
+	write(`{"log_level":"loud"}`, time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	if got := logLevel.Level(); got != slog.LevelError {
+		t.Errorf("log level = %s after an invalid edit, want ERROR", got)
+	}
+}
+
+// TestConfigFileSameModTime rewrites the file within the mtime resolution of
+// a coarse file system: only the size tells the versions apart.
+func TestConfigFileSameModTime(t *testing.T) {
+	r, _ := newTestReconfigurer(t)
+	r.file = filepath.Join(t.TempDir(), "config.json")
+	mtime := time.Now().Truncate(time.Second)
+	for _, body := range []string{`{"log_level":"warn"}`, `{"log_level":"error"}`, `{"log_level":"debug","sampler":"always_off"}`} {
+		if err := os.WriteFile(r.file, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(r.file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.load(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := logLevel.Level(); got != slog.LevelDebug {
+		t.Errorf("log level = %s, want DEBUG from the last version", got)
+	}
+}
+
+func TestConfigFileInvalidAtStart(t *testing.T) {
+	r, _ := newTestReconfigurer(t)
+	r.file = filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(r.file, []byte(`{"sampler":"bogus"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.start(context.Background()); err == nil {
+		r.shutdown(context.Background())
+		t.Fatal("start() = nil with an invalid config file")
+	}
+}
+
+// waitUntil polls cond until it holds or the timeout expires.
+func waitUntil(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
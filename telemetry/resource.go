@@ -0,0 +1,80 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const defaultEnvironment = "development"
+
+// newResource describes the running service. Values passed through options
+// act as defaults: OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES are applied
+// last and win over them, so docker-compose can rename a service or tag a
+// replica without a rebuild.
+func newResource(ctx context.Context, cfg *config) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{
+		semconv.DeploymentEnvironment(cfg.environment),
+	}
+	if cfg.serviceName != "" {
+		attrs = append(attrs, semconv.ServiceName(cfg.serviceName))
+	}
+	if version := cfg.serviceVersion; version != "" {
+		attrs = append(attrs, semconv.ServiceVersion(version))
+	} else if version := buildVersion(); version != "" {
+		attrs = append(attrs, semconv.ServiceVersion(version))
+	}
+	attrs = append(attrs, cfg.resourceAttrs...)
+
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(attrs...),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithOS(),
+		resource.WithProcessPID(),
+		resource.WithProcessExecutableName(),
+		resource.WithProcessOwner(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithProcessRuntimeDescription(),
+		resource.WithDetectors(newContainerDetector()),
+		resource.WithFromEnv(),
+	)
+	if errors.Is(err, resource.ErrPartialResource) || errors.Is(err, resource.ErrSchemaURLConflict) {
+		// A detector that cannot see its data (no container, restricted
+		// /proc) should not keep the service from starting.
+		otel.Handle(err)
+		return res, nil
+	}
+	return res, err
+}
+
+// readBuildInfo is replaced in tests, whose binaries record no version.
+var readBuildInfo = debug.ReadBuildInfo
+
+// buildVersion returns the module version recorded in the binary, or the VCS
+// revision for development builds.
+func buildVersion() string {
+	info, ok := readBuildInfo()
+	if !ok {
+		return ""
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			if len(s.Value) > 12 {
+				return s.Value[:12]
+			}
+			return s.Value
+		}
+	}
+	return ""
+}
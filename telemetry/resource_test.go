@@ -0,0 +1,92 @@
+package telemetry
+
+import (
+	"context"
+	"runtime/debug"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestResourcePrecedence(t *testing.T) {
+	release := &debug.BuildInfo{Main: debug.Module{Version: "v1.2.3"}}
+	devel := &debug.BuildInfo{
+		Main:     debug.Module{Version: "(devel)"},
+		Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "0123456789abcdef0123"}},
+	}
+	tests := []struct {
+		name                                   string
+		build                                  *debug.BuildInfo
+		opts                                   []Option
+		resourceAttrs, serviceName             string
+		wantName, wantVersion, wantEnvironment string
+	}{
+		{
+			name:            "build info",
+			build:           release,
+			opts:            []Option{WithServiceName("service-a")},
+			wantName:        "service-a",
+			wantVersion:     "v1.2.3",
+			wantEnvironment: "development",
+		},
+		{
+			name:            "revision of a development build",
+			build:           devel,
+			opts:            []Option{WithServiceName("service-a")},
+			wantName:        "service-a",
+			wantVersion:     "0123456789ab",
+			wantEnvironment: "development",
+		},
+		{
+			name:            "options over build info",
+			build:           release,
+			opts:            []Option{WithServiceName("service-a"), WithServiceVersion("2.0.0"), WithDeploymentEnvironment("staging")},
+			wantName:        "service-a",
+			wantVersion:     "2.0.0",
+			wantEnvironment: "staging",
+		},
+		{
+			name:            "resource attributes over options",
+			build:           release,
+			opts:            []Option{WithServiceName("service-a"), WithServiceVersion("2.0.0"), WithDeploymentEnvironment("staging")},
+			resourceAttrs:   "service.name=renamed,service.version=3.0.0,deployment.environment=production",
+			wantName:        "renamed",
+			wantVersion:     "3.0.0",
+			wantEnvironment: "production",
+		},
+		{
+			name:            "service name over resource attributes",
+			build:           release,
+			opts:            []Option{WithServiceName("service-a")},
+			resourceAttrs:   "service.name=renamed",
+			serviceName:     "service-a-replica",
+			wantName:        "service-a-replica",
+			wantVersion:     "v1.2.3",
+			wantEnvironment: "development",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := readBuildInfo
+			readBuildInfo = func() (*debug.BuildInfo, bool) { return tt.build, true }
+			t.Cleanup(func() { readBuildInfo = prev })
+			t.Setenv("OTEL_RESOURCE_ATTRIBUTES", tt.resourceAttrs)
+			t.Setenv("OTEL_SERVICE_NAME", tt.serviceName)
+
+			res, err := newResource(context.Background(), newConfig(tt.opts...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range map[attribute.Key]string{
+				semconv.ServiceNameKey:           tt.wantName,
+				semconv.ServiceVersionKey:        tt.wantVersion,
+				semconv.DeploymentEnvironmentKey: tt.wantEnvironment,
+			} {
+				if got, _ := res.Set().Value(key); got.AsString() != want {
+					t.Errorf("%s = %q, want %q", key, got.AsString(), want)
+				}
+			}
+		})
+	}
+}
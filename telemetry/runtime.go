@@ -0,0 +1,187 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"runtime/metrics"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var processStart = time.Now()
+
+// runtimeMetricsEnabled reports whether Go runtime and process metrics are
+// recorded: WithRuntimeMetrics wins over OTEL_RUNTIME_METRICS, and both
+// default to true.
+func runtimeMetricsEnabled(cfg *config) (bool, error) {
+	if cfg.runtimeMetrics != nil {
+		return *cfg.runtimeMetrics, nil
+	}
+	v := os.Getenv("OTEL_RUNTIME_METRICS")
+	if v == "" {
+		return true, nil
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid OTEL_RUNTIME_METRICS %q: %w", v, err)
+	}
+	return enabled, nil
+}
+
+// runtimeProducers returns the producers feeding the runtime histograms,
+// go.schedule.duration from the runtime instrumentation and the GC pauses,
+// to every metric reader. They are empty when runtime metrics are disabled.
+func runtimeProducers(enabled bool) []sdkmetric.Producer {
+	if !enabled {
+		return nil
+	}
+	return []sdkmetric.Producer{runtimeHistograms{schedule: runtime.NewProducer()}}
+}
+
+// startRuntimeMetrics registers the Go runtime instruments (heap, goroutines,
+// GC goal, GOMAXPROCS, ...) and the process instruments on mp. The runtime
+// instrumentation reports the pre-semconv process.runtime.go.* names unless
+// OTEL_GO_X_DEPRECATED_RUNTIME_METRICS is false.
+func startRuntimeMetrics(mp metric.MeterProvider) error {
+	if err := runtime.Start(runtime.WithMeterProvider(mp)); err != nil {
+		return fmt.Errorf("failed to start runtime metrics: %w", err)
+	}
+
+	meter := mp.Meter("telemetry/process")
+	cpuTime, err := meter.Float64ObservableCounter("process.cpu.time",
+		metric.WithDescription("Total CPU seconds broken down by different CPU modes."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return fmt.Errorf("failed to create process.cpu.time: %w", err)
+	}
+	fds, err := meter.Int64ObservableUpDownCounter("process.unix.file_descriptor.count",
+		metric.WithDescription("Number of unix file descriptors in use by the process."),
+		metric.WithUnit("{file_descriptor}"))
+	if err != nil {
+		return fmt.Errorf("failed to create process.unix.file_descriptor.count: %w", err)
+	}
+
+	var (
+		user   = metric.WithAttributes(attribute.String("cpu.mode", "user"))
+		system = metric.WithAttributes(attribute.String("cpu.mode", "system"))
+	)
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		if u, s, ok := cpuTimes(); ok {
+			o.ObserveFloat64(cpuTime, u.Seconds(), user)
+			o.ObserveFloat64(cpuTime, s.Seconds(), system)
+		}
+		// /proc/self/fd only exists on Linux, which is what the services run
+		// on; elsewhere the instrument simply reports nothing.
+		if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+			o.ObserveInt64(fds, int64(len(entries)))
+		}
+		return nil
+	}, cpuTime, fds)
+	if err != nil {
+		return fmt.Errorf("failed to register process metrics: %w", err)
+	}
+	return nil
+}
+
+// runtimeHistogram is a histogram of the runtime/metrics package, not
+// covered by the runtime instrumentation, exported under an OpenTelemetry
+// name.
+type runtimeHistogram struct {
+	source      string
+	name        string
+	description string
+}
+
+var runtimeHistogramMetrics = []runtimeHistogram{
+	{
+		source:      "/sched/pauses/total/gc:seconds",
+		name:        "go.gc.pause.duration",
+		description: "Stop-the-world pauses caused by the garbage collector.",
+	},
+}
+
+// runtimeHistograms produces the runtime histograms, which have no
+// asynchronous instrument equivalent: go.schedule.duration from the runtime
+// instrumentation's producer, and the GC pauses. It reports them under its
+// own instrumentation scope: the Prometheus exporter rejects a scope
+// reported both by a meter and by a producer, as the runtime
+// instrumentation's would be.
+type runtimeHistograms struct {
+	schedule *runtime.Producer
+}
+
+func (h runtimeHistograms) Produce(ctx context.Context) ([]metricdata.ScopeMetrics, error) {
+	scheduled, err := h.schedule.Produce(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []metricdata.Metrics
+	for _, sm := range scheduled {
+		out = append(out, sm.Metrics...)
+	}
+
+	samples := make([]metrics.Sample, len(runtimeHistogramMetrics))
+	for i, m := range runtimeHistogramMetrics {
+		samples[i].Name = m.source
+	}
+	metrics.Read(samples)
+
+	for i, m := range runtimeHistogramMetrics {
+		if samples[i].Value.Kind() != metrics.KindFloat64Histogram {
+			return nil, fmt.Errorf("runtime metric %s is not available", m.source)
+		}
+		out = append(out, metricdata.Metrics{
+			Name:        m.name,
+			Description: m.description,
+			Unit:        "s",
+			Data: metricdata.Histogram[float64]{
+				Temporality: metricdata.CumulativeTemporality,
+				DataPoints:  []metricdata.HistogramDataPoint[float64]{histogramPoint(samples[i].Value.Float64Histogram())},
+			},
+		})
+	}
+	return []metricdata.ScopeMetrics{{
+		Scope:   instrumentation.Scope{Name: "telemetry/runtime"},
+		Metrics: out,
+	}}, nil
+}
+
+// histogramPoint converts a runtime histogram, whose buckets carry both
+// bounds, into an OpenTelemetry data point with upper bounds only. The sum
+// is estimated from the lower bound of each bucket.
+func histogramPoint(h *metrics.Float64Histogram) metricdata.HistogramDataPoint[float64] {
+	bounds, counts := h.Buckets[1:], h.Counts
+	if math.IsInf(bounds[len(bounds)-1], 1) {
+		bounds = bounds[:len(bounds)-1]
+	} else {
+		counts = append(counts, 0)
+	}
+
+	var (
+		count uint64
+		sum   float64
+	)
+	for i, c := range counts {
+		count += c
+		if lower := h.Buckets[i]; c > 0 && !math.IsInf(lower, -1) {
+			sum += lower * float64(c)
+		}
+	}
+	return metricdata.HistogramDataPoint[float64]{
+		StartTime:    processStart,
+		Time:         time.Now(),
+		Count:        count,
+		Sum:          sum,
+		Bounds:       bounds,
+		BucketCounts: counts,
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package telemetry
+
+import "time"
+
+// cpuTimes reports nothing outside Unix: process.cpu.time has no data points.
+func cpuTimes() (user, system time.Duration, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,105 @@
+package telemetry
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"runtime/metrics"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestHistogramPoint(t *testing.T) {
+	inf := math.Inf(1)
+	tests := []struct {
+		name       string
+		h          metrics.Float64Histogram
+		wantBounds []float64
+		wantCounts []uint64
+		wantCount  uint64
+		wantSum    float64
+	}{
+		{
+			name:       "infinite edges",
+			h:          metrics.Float64Histogram{Buckets: []float64{-inf, 0, 1, 2, inf}, Counts: []uint64{1, 2, 3, 4}},
+			wantBounds: []float64{0, 1, 2},
+			wantCounts: []uint64{1, 2, 3, 4},
+			wantCount:  10,
+			// The -Inf bucket has no lower bound to estimate from.
+			wantSum: 0*2 + 1*3 + 2*4,
+		},
+		{
+			name:       "finite edges",
+			h:          metrics.Float64Histogram{Buckets: []float64{0, 1, 2}, Counts: []uint64{5, 1}},
+			wantBounds: []float64{1, 2},
+			wantCounts: []uint64{5, 1, 0},
+			wantCount:  6,
+			wantSum:    1,
+		},
+		{
+			name:       "only the +Inf edge",
+			h:          metrics.Float64Histogram{Buckets: []float64{0.5, 1, inf}, Counts: []uint64{2, 1}},
+			wantBounds: []float64{1},
+			wantCounts: []uint64{2, 1},
+			wantCount:  3,
+			wantSum:    0.5*2 + 1,
+		},
+		{
+			name:       "empty",
+			h:          metrics.Float64Histogram{Buckets: []float64{-inf, 1, inf}, Counts: []uint64{0, 0}},
+			wantBounds: []float64{1},
+			wantCounts: []uint64{0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dp := histogramPoint(&tt.h)
+			if !reflect.DeepEqual(dp.Bounds, tt.wantBounds) || !reflect.DeepEqual(dp.BucketCounts, tt.wantCounts) {
+				t.Errorf("bounds, counts = %v, %v, want %v, %v", dp.Bounds, dp.BucketCounts, tt.wantBounds, tt.wantCounts)
+			}
+			if dp.Count != tt.wantCount || dp.Sum != tt.wantSum {
+				t.Errorf("count, sum = %d, %g, want %d, %g", dp.Count, dp.Sum, tt.wantCount, tt.wantSum)
+			}
+			// What OpenTelemetry requires of any data point.
+			if len(dp.BucketCounts) != len(dp.Bounds)+1 {
+				t.Errorf("%d bucket counts for %d bounds", len(dp.BucketCounts), len(dp.Bounds))
+			}
+			var total uint64
+			for _, c := range dp.BucketCounts {
+				total += c
+			}
+			if total != dp.Count {
+				t.Errorf("bucket counts add up to %d, count is %d", total, dp.Count)
+			}
+		})
+	}
+}
+
+func TestRuntimeHistograms(t *testing.T) {
+	scopes, err := runtimeHistograms{schedule: runtime.NewProducer()}.Produce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scopes) != 1 || scopes[0].Scope.Name != "telemetry/runtime" {
+		t.Fatalf("scopes = %+v, want telemetry/runtime only", scopes)
+	}
+	got := map[string]bool{}
+	for _, m := range scopes[0].Metrics {
+		h, ok := m.Data.(metricdata.Histogram[float64])
+		if !ok || len(h.DataPoints) != 1 {
+			t.Errorf("%s is not a single histogram data point: %T", m.Name, m.Data)
+			continue
+		}
+		for _, b := range h.DataPoints[0].Bounds {
+			if math.IsInf(b, 0) {
+				t.Errorf("%s has an infinite bound", m.Name)
+			}
+		}
+		got[m.Name] = true
+	}
+	if !got["go.schedule.duration"] || !got["go.gc.pause.duration"] {
+		t.Errorf("produced %v, want go.schedule.duration and go.gc.pause.duration", got)
+	}
+}
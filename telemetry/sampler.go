@@ -0,0 +1,222 @@
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"telemetry/tailsampling"
+)
+
+// SamplingRule samples the spans matching Pattern with probability Ratio.
+// Pattern uses path.Match syntax, except that * and ? also match '/', and
+// is compared against the span name and the route attributes set by
+// otelhttp and otelgrpc ("/start", "/health*", "service.ServiceB/*", ...).
+type SamplingRule struct {
+	Pattern string
+	Ratio   float64
+}
+
+type ruleSampler struct {
+	rules    []SamplingRule
+	samplers []sdktrace.Sampler
+	fallback sdktrace.Sampler
+}
+
+// RuleSampler returns a sampler that applies the ratio of the first rule
+// matching a span, and defers to fallback when no rule matches. Rules are
+// evaluated when the span starts, so they can only see its name and start
+// attributes; keeping failed requests is the job of tail sampling.
+func RuleSampler(rules []SamplingRule, fallback sdktrace.Sampler) sdktrace.Sampler {
+	if fallback == nil {
+		fallback = sdktrace.AlwaysSample()
+	}
+	s := &ruleSampler{rules: rules, fallback: fallback}
+	for _, r := range rules {
+		s.samplers = append(s.samplers, sdktrace.TraceIDRatioBased(r.Ratio))
+	}
+	return s
+}
+
+func (s *ruleSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for i, r := range s.rules {
+		if r.matches(p) {
+			return s.samplers[i].ShouldSample(p)
+		}
+	}
+	return s.fallback.ShouldSample(p)
+}
+
+func (s *ruleSampler) Description() string {
+	parts := make([]string, 0, len(s.rules))
+	for _, r := range s.rules {
+		parts = append(parts, fmt.Sprintf("%s=%g", r.Pattern, r.Ratio))
+	}
+	return fmt.Sprintf("RuleSampler{%s;fallback=%s}", strings.Join(parts, ","), s.fallback.Description())
+}
+
+var routeKeys = []attribute.Key{
+	semconv.HTTPRouteKey,
+	semconv.URLPathKey,
+	"http.target",
+	semconv.RPCMethodKey,
+}
+
+func (r SamplingRule) matches(p sdktrace.SamplingParameters) bool {
+	if globMatch(r.Pattern, p.Name) {
+		return true
+	}
+	for _, kv := range p.Attributes {
+		for _, key := range routeKeys {
+			if kv.Key == key && globMatch(r.Pattern, kv.Value.Emit()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// globMatch is path.Match with '/' made an ordinary character, so that the
+// catch-all "*" matches span names such as "GET /start" and RPC methods
+// such as "service.ServiceB/DoSomething".
+func globMatch(pattern, s string) bool {
+	ok, _ := path.Match(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(s, "/", "\x00"))
+	return ok
+}
+
+// samplerFromEnv builds the sampler named by OTEL_TRACES_SAMPLER, using
+// OTEL_TRACES_SAMPLER_ARG as its ratio or, for the rule samplers, as a
+// comma separated list of pattern=ratio entries:
+//
+//	OTEL_TRACES_SAMPLER=parentbased_rules
+//	OTEL_TRACES_SAMPLER_ARG=/start=1,/health*=0.01,*=0.1
+func samplerFromEnv() (sdktrace.Sampler, error) {
+	s, err := newSampler(os.Getenv("OTEL_TRACES_SAMPLER"), os.Getenv("OTEL_TRACES_SAMPLER_ARG"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_TRACES_SAMPLER: %w", err)
+	}
+	return s, nil
+}
+
+// newSampler builds a sampler from an OTEL_TRACES_SAMPLER name and argument.
+func newSampler(name, arg string) (sdktrace.Sampler, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	arg = strings.TrimSpace(arg)
+
+	parentBased := strings.HasPrefix(name, "parentbased_")
+	var (
+		root sdktrace.Sampler
+		err  error
+	)
+	switch strings.TrimPrefix(name, "parentbased_") {
+	case "":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case "always_on":
+		root = sdktrace.AlwaysSample()
+	case "always_off":
+		root = sdktrace.NeverSample()
+	case "traceidratio":
+		var ratio float64
+		ratio, err = parseRatio(arg)
+		root = sdktrace.TraceIDRatioBased(ratio)
+	case "rules":
+		var rules []SamplingRule
+		rules, err = ParseSamplingRules(arg)
+		root = RuleSampler(rules, nil)
+	default:
+		err = fmt.Errorf("unsupported sampler %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if parentBased {
+		return sdktrace.ParentBased(root), nil
+	}
+	return root, nil
+}
+
+// ParseSamplingRules parses "pattern=ratio" entries separated by commas. A
+// "*" pattern is kept as a catch-all and should come last.
+func ParseSamplingRules(s string) ([]SamplingRule, error) {
+	var rules []SamplingRule
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid sampling rule %q: want pattern=ratio", entry)
+		}
+		pattern := strings.TrimSpace(entry[:i])
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid sampling rule %q: %w", entry, err)
+		}
+		ratio, err := parseRatio(entry[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid sampling rule %q: %w", entry, err)
+		}
+		rules = append(rules, SamplingRule{Pattern: pattern, Ratio: ratio})
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no sampling rules in %q", s)
+	}
+	return rules, nil
+}
+
+func parseRatio(s string) (float64, error) {
+	if s == "" {
+		return 1, nil
+	}
+	ratio, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sampling ratio %q: %w", s, err)
+	}
+	if ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("sampling ratio %g out of range [0, 1]", ratio)
+	}
+	return ratio, nil
+}
+
+// tailSamplingOptions returns the tail sampling configuration given through
+// WithTailSampling or, failing that, through the environment:
+//
+//	OTEL_TAIL_SAMPLING_RATIO    probability of keeping traces matching no policy
+//	OTEL_TAIL_SAMPLING_LATENCY  keep traces with a span slower than this
+//
+// Tail sampling is enabled when either variable is set; traces with errors
+// are always kept.
+func tailSamplingOptions(cfg *config) ([]tailsampling.Option, bool, error) {
+	if cfg.tailSampling != nil {
+		return append([]tailsampling.Option{tailsampling.WithPolicies(tailsampling.ErrorPolicy())}, cfg.tailSampling...), true, nil
+	}
+
+	ratio, latency := os.Getenv("OTEL_TAIL_SAMPLING_RATIO"), os.Getenv("OTEL_TAIL_SAMPLING_LATENCY")
+	if ratio == "" && latency == "" {
+		return nil, false, nil
+	}
+
+	opts := []tailsampling.Option{tailsampling.WithPolicies(tailsampling.ErrorPolicy())}
+	if ratio != "" {
+		r, err := parseRatio(ratio)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid OTEL_TAIL_SAMPLING_RATIO: %w", err)
+		}
+		opts = append(opts, tailsampling.WithSamplingRatio(r))
+	}
+	if latency != "" {
+		d, err := time.ParseDuration(latency)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid OTEL_TAIL_SAMPLING_LATENCY: %w", err)
+		}
+		opts = append(opts, tailsampling.WithPolicies(tailsampling.LatencyPolicy(d)))
+	}
+	return opts, true, nil
+}
@@ -0,0 +1,138 @@
+package telemetry
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestParseSamplingRules(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []SamplingRule
+		wantErr bool
+	}{
+		{in: "/start=1", want: []SamplingRule{{"/start", 1}}},
+		{
+			in:   " /start=1 , /health*=0.01,*=0 ",
+			want: []SamplingRule{{"/start", 1}, {"/health*", 0.01}, {"*", 0}},
+		},
+		{in: "a=b=0.5", want: []SamplingRule{{"a=b", 0.5}}},
+		{in: "/start=", want: []SamplingRule{{"/start", 1}}},
+		{in: "", wantErr: true},
+		{in: "/start", wantErr: true},
+		{in: "=0.5", wantErr: true},
+		{in: "/start=2", wantErr: true},
+		{in: "/start=half", wantErr: true},
+		{in: "[=0.5", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSamplingRules(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSamplingRules(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSamplingRules(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestRuleSampler(t *testing.T) {
+	rules, err := ParseSamplingRules("/start=1,/health*=0,service.ServiceC/*=0,*=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampler := RuleSampler(rules, nil)
+	noCatchAll := RuleSampler(rules[:2], nil)
+
+	tests := []struct {
+		name  string
+		attrs []attribute.KeyValue
+		want  bool
+		// wantFallback is the decision without the catch-all rule.
+		wantFallback bool
+	}{
+		{name: "GET /start", want: false, wantFallback: true},
+		{name: "GET", attrs: []attribute.KeyValue{semconv.HTTPRoute("/start")}, want: true, wantFallback: true},
+		{name: "GET", attrs: []attribute.KeyValue{semconv.URLPath("/healthz")}, want: false, wantFallback: false},
+		{name: "service.ServiceB/DoSomething", want: false, wantFallback: true},
+		{name: "rpc", attrs: []attribute.KeyValue{semconv.RPCMethod("service.ServiceC/DoSomethingElse")}, want: false, wantFallback: true},
+	}
+	for _, tt := range tests {
+		p := sdktrace.SamplingParameters{
+			TraceID:    trace.TraceID{1},
+			Name:       tt.name,
+			Attributes: tt.attrs,
+		}
+		if got := sampler.ShouldSample(p).Decision == sdktrace.RecordAndSample; got != tt.want {
+			t.Errorf("%s %v sampled = %v, want %v", tt.name, tt.attrs, got, tt.want)
+		}
+		if got := noCatchAll.ShouldSample(p).Decision == sdktrace.RecordAndSample; got != tt.wantFallback {
+			t.Errorf("%s %v sampled without catch-all = %v, want %v", tt.name, tt.attrs, got, tt.wantFallback)
+		}
+	}
+}
+
+func TestRuleSamplerFirstMatchWins(t *testing.T) {
+	p := sdktrace.SamplingParameters{TraceID: trace.TraceID{1}, Name: "/start"}
+	for _, tt := range []struct {
+		rules string
+		want  bool
+	}{
+		{"/start=1,*=0", true},
+		{"*=0,/start=1", false},
+	} {
+		rules, err := ParseSamplingRules(tt.rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sampled := RuleSampler(rules, sdktrace.NeverSample()).ShouldSample(p).Decision == sdktrace.RecordAndSample
+		if sampled != tt.want {
+			t.Errorf("%s: sampled = %v, want %v", tt.rules, sampled, tt.want)
+		}
+	}
+}
+
+func TestSamplerFromEnv(t *testing.T) {
+	tests := []struct {
+		sampler, arg string
+		want         string
+		wantErr      bool
+	}{
+		{want: "ParentBased{root:AlwaysOnSampler"},
+		{sampler: "always_off", want: "AlwaysOffSampler"},
+		{sampler: " ParentBased_Always_Off ", want: "ParentBased{root:AlwaysOffSampler"},
+		{sampler: "traceidratio", arg: "0.25", want: "TraceIDRatioBased{0.25}"},
+		{sampler: "traceidratio", want: "AlwaysOnSampler"},
+		{sampler: "parentbased_rules", arg: "/start=1,*=0.1", want: "ParentBased{root:RuleSampler{/start=1,*=0.1;fallback=AlwaysOnSampler}"},
+		{sampler: "traceidratio", arg: "1.5", wantErr: true},
+		{sampler: "rules", wantErr: true},
+		{sampler: "jaeger_remote", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("OTEL_TRACES_SAMPLER", tt.sampler)
+		t.Setenv("OTEL_TRACES_SAMPLER_ARG", tt.arg)
+		s, err := samplerFromEnv()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("samplerFromEnv() with %q %q = %s, want error", tt.sampler, tt.arg, s.Description())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("samplerFromEnv() with %q %q: %v", tt.sampler, tt.arg, err)
+			continue
+		}
+		if got := s.Description(); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("samplerFromEnv() with %q %q = %s, want %s", tt.sampler, tt.arg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package spool
+
+import "time"
+
+type config struct {
+	maxBytes      int64
+	segmentBytes  int64
+	maxAge        time.Duration
+	retryInterval time.Duration
+}
+
+// Option configures a Client.
+type Option func(*config)
+
+// WithMaxBytes caps the size of the log on disk, 64 MiB by default. The
+// oldest segments are discarded to stay under it.
+func WithMaxBytes(n int64) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.maxBytes = n
+		}
+	}
+}
+
+// WithSegmentBytes sets the size after which a new segment file is started,
+// 4 MiB by default. Segments are deleted whole once replayed.
+func WithSegmentBytes(n int64) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.segmentBytes = n
+		}
+	}
+}
+
+// WithMaxAge sets how old a spooled batch may be and still be replayed, 24
+// hours by default.
+func WithMaxAge(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.maxAge = d
+		}
+	}
+}
+
+// WithRetryInterval sets how often the log is replayed while the collector
+// is unreachable, 5 seconds by default.
+func WithRetryInterval(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.retryInterval = d
+		}
+	}
+}
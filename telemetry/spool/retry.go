@@ -0,0 +1,48 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// retryable reports whether a failed upload may succeed if sent again:
+// the collector was unreachable, overloaded or too slow. Batches it
+// rejected as invalid or too large would be rejected again, so they are
+// not worth keeping.
+//
+// gRPC errors are classified by status code and HTTP errors by status,
+// taken from a HTTPStatusCode() int method on the error.
+func retryable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+			return true
+		}
+		return false
+	}
+	var sc interface{ HTTPStatusCode() int }
+	if errors.As(err, &sc) {
+		switch sc.HTTPStatusCode() {
+		case http.StatusTooManyRequests, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// otlptracehttp does not export its error type; the responses it would
+	// retry, 429, 502, 503 and 504, come back under this prefix.
+	return strings.HasPrefix(err.Error(), "retry-able request failure")
+}
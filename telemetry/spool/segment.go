@@ -0,0 +1,150 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A segment file is a sequence of records:
+//
+//	length    uint32  payload length
+//	checksum  uint32  CRC-32C of timestamp and payload
+//	timestamp int64   unix nanoseconds when the batch was spilled
+//	payload   []byte  protobuf ExportTraceServiceRequest
+//
+// Records are appended with a single write followed by fsync, so a crash can
+// at worst leave a torn record at the end of the newest segment; it fails
+// the checksum and is cut off when the directory is opened again.
+const (
+	headerSize    = 16
+	segmentSuffix = ".wal"
+)
+
+var (
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+	errCorrupt = errors.New("corrupt spool record")
+)
+
+type segment struct {
+	seq     uint64
+	path    string
+	size    int64
+	records int
+	newest  time.Time
+
+	// Progress of the replay, kept in memory only: after a crash the
+	// segment is replayed from the start, so batches are delivered at least
+	// once.
+	offset   int64
+	replayed int
+}
+
+func segmentPath(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+func encodeRecord(ts time.Time, payload []byte) []byte {
+	buf := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(ts.UnixNano()))
+	copy(buf[headerSize:], payload)
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(buf[8:], castagnoli))
+	return buf
+}
+
+// readRecord reads the record at the current position of r. It returns
+// io.EOF at a clean end of segment and errCorrupt for torn or damaged
+// records.
+func readRecord(r *bufio.Reader, maxPayload int64) (time.Time, []byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return time.Time{}, nil, io.EOF
+		}
+		return time.Time{}, nil, errCorrupt
+	}
+	n := binary.BigEndian.Uint32(header[0:4])
+	if int64(n) > maxPayload {
+		return time.Time{}, nil, errCorrupt
+	}
+	body := make([]byte, 8+int(n))
+	copy(body, header[8:16])
+	if _, err := io.ReadFull(r, body[8:]); err != nil {
+		return time.Time{}, nil, errCorrupt
+	}
+	if crc32.Checksum(body, castagnoli) != binary.BigEndian.Uint32(header[4:8]) {
+		return time.Time{}, nil, errCorrupt
+	}
+	ts := time.Unix(0, int64(binary.BigEndian.Uint64(header[8:16])))
+	return ts, body[8:], nil
+}
+
+// loadSegments indexes the segment files left in dir by a previous run,
+// oldest first. Torn tails are truncated and empty segments removed.
+func loadSegments(dir string, maxPayload int64) ([]*segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []*segment
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seg, err := scanSegment(filepath.Join(dir, name), seq, maxPayload)
+		if err != nil {
+			return nil, err
+		}
+		if seg != nil {
+			segments = append(segments, seg)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].seq < segments[j].seq })
+	return segments, nil
+}
+
+func scanSegment(path string, seq uint64, maxPayload int64) (*segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seg := &segment{seq: seq, path: path}
+	r := bufio.NewReader(f)
+	for {
+		ts, payload, err := readRecord(r, maxPayload)
+		if err != nil {
+			break
+		}
+		seg.size += headerSize + int64(len(payload))
+		seg.records++
+		seg.newest = ts
+	}
+
+	if seg.records == 0 {
+		return nil, os.Remove(path)
+	}
+	if fi, err := f.Stat(); err == nil && fi.Size() > seg.size {
+		if err := os.Truncate(path, seg.size); err != nil {
+			return nil, fmt.Errorf("failed to truncate torn spool segment: %w", err)
+		}
+	}
+	return seg, nil
+}
@@ -0,0 +1,402 @@
+// Package spool provides an OTLP trace client that keeps span batches on
+// disk while the collector is unreachable and replays them once it is back.
+package spool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/metric"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultMaxBytes      = 64 << 20
+	defaultSegmentBytes  = 4 << 20
+	defaultMaxAge        = 24 * time.Hour
+	defaultRetryInterval = 5 * time.Second
+	defaultUploadTimeout = 10 * time.Second
+)
+
+// Client is an otlptrace.Client that forwards batches to another client and
+// spills them to a write-ahead log in a directory when the upload fails.
+// While the log holds batches, new ones are appended to it directly so that
+// spans reach the collector in order; a background loop replays the log,
+// oldest segment first, every retry interval.
+//
+// The log is bounded by size and age: the oldest segments are discarded when
+// it grows past the size cap, and batches older than the age cap are
+// dropped instead of being replayed. Each directory must belong to a single
+// process.
+//
+// Only failures that may pass on a later attempt are spooled: the
+// collector being unreachable, overloaded or timing out. Batches it rejects
+// outright are dropped, and reported through otel.Handle.
+type Client struct {
+	next          otlptrace.Client
+	dir           string
+	maxBytes      int64
+	segmentBytes  int64
+	maxAge        time.Duration
+	retryInterval time.Duration
+
+	mu        sync.Mutex
+	segments  []*segment
+	active    *os.File
+	size      int64
+	nextSeq   uint64
+	replaying *segment
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	cancel   context.CancelFunc
+	batches  metric.Int64Counter
+}
+
+var _ otlptrace.Client = (*Client)(nil)
+
+// ErrSpooled is returned by UploadTraces when the batch was spilled to disk
+// instead of uploaded. The batch is not lost, it will be replayed later, but
+// it has not reached the collector yet either.
+var ErrSpooled = errors.New("spans spooled to disk")
+
+// New returns a Client spooling the batches of next to dir, which is created
+// if needed. Segments left in dir by a previous run are replayed.
+func New(next otlptrace.Client, dir string, opts ...Option) (*Client, error) {
+	cfg := config{
+		maxBytes:      defaultMaxBytes,
+		segmentBytes:  defaultSegmentBytes,
+		maxAge:        defaultMaxAge,
+		retryInterval: defaultRetryInterval,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	// Keep several segments under the cap, so that enforcing it discards
+	// the oldest batches rather than the whole log.
+	cfg.segmentBytes = max(min(cfg.segmentBytes, cfg.maxBytes/4), 1)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	segments, err := loadSegments(dir, cfg.maxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load spool: %w", err)
+	}
+
+	c := &Client{
+		next:          next,
+		dir:           dir,
+		maxBytes:      cfg.maxBytes,
+		segmentBytes:  cfg.segmentBytes,
+		maxAge:        cfg.maxAge,
+		retryInterval: cfg.retryInterval,
+		segments:      segments,
+	}
+	for _, s := range segments {
+		c.size += s.size
+		c.nextSeq = s.seq + 1
+	}
+
+	meter := otel.Meter("telemetry/spool")
+	c.batches, _ = meter.Int64Counter("otel.spool.batches",
+		metric.WithDescription("Span batches spilled to, replayed from or discarded by the on-disk spool."),
+		metric.WithUnit("{batch}"))
+	_, _ = meter.Int64ObservableGauge("otel.spool.size",
+		metric.WithDescription("Bytes of span batches waiting in the on-disk spool."),
+		metric.WithUnit("By"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			o.Observe(c.size)
+			return nil
+		}))
+	return c, nil
+}
+
+// Start starts the wrapped client and the replay loop.
+func (c *Client) Start(ctx context.Context) error {
+	if err := c.next.Start(ctx); err != nil {
+		return err
+	}
+	var replayCtx context.Context
+	replayCtx, c.cancel = context.WithCancel(context.Background())
+	c.stop, c.done = make(chan struct{}), make(chan struct{})
+	go c.run(replayCtx)
+	return nil
+}
+
+// Stop ends the replay loop, syncs the log and stops the wrapped client.
+// Batches still on disk are replayed by the next process using the
+// directory.
+func (c *Client) Stop(ctx context.Context) error {
+	c.stopOnce.Do(func() {
+		if c.stop != nil {
+			close(c.stop)
+			c.cancel()
+			<-c.done
+		}
+	})
+
+	c.mu.Lock()
+	err := c.closeActiveLocked()
+	c.mu.Unlock()
+	return errors.Join(err, c.next.Stop(ctx))
+}
+
+// UploadTraces uploads the batch, or spills it when the upload fails with
+// a retryable error or earlier batches are still waiting on disk, in which
+// case it returns ErrSpooled.
+func (c *Client) UploadTraces(ctx context.Context, spans []*tracepb.ResourceSpans) error {
+	if !c.backlogged() {
+		err := c.next.UploadTraces(ctx, spans)
+		if err == nil || !retryable(err) {
+			return err
+		}
+		otel.Handle(fmt.Errorf("spooling spans after failed upload: %w", err))
+	}
+
+	payload, err := proto.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+	if err := c.append(payload); err != nil {
+		return fmt.Errorf("failed to spool spans: %w", err)
+	}
+	c.batches.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "spilled")))
+	return ErrSpooled
+}
+
+func (c *Client) backlogged() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.segments) > 0
+}
+
+func (c *Client) append(payload []byte) error {
+	record := encodeRecord(time.Now(), payload)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active == nil || c.segments[len(c.segments)-1].size >= c.segmentBytes {
+		if err := c.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	seg := c.segments[len(c.segments)-1]
+	if _, err := c.active.Write(record); err != nil {
+		return err
+	}
+	if err := c.active.Sync(); err != nil {
+		return err
+	}
+	seg.size += int64(len(record))
+	seg.records++
+	seg.newest = time.Now()
+	c.size += int64(len(record))
+
+	c.enforceSizeLocked()
+	return nil
+}
+
+// rotateLocked closes the active segment and opens a new one.
+func (c *Client) rotateLocked() error {
+	if err := c.closeActiveLocked(); err != nil {
+		return err
+	}
+	seg := &segment{seq: c.nextSeq, path: segmentPath(c.dir, c.nextSeq)}
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	// Make the new file itself durable, not only its contents.
+	if d, err := os.Open(c.dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	c.nextSeq++
+	c.active = f
+	c.segments = append(c.segments, seg)
+	return nil
+}
+
+func (c *Client) closeActiveLocked() error {
+	if c.active == nil {
+		return nil
+	}
+	err := errors.Join(c.active.Sync(), c.active.Close())
+	c.active = nil
+	return err
+}
+
+// enforceSizeLocked discards the oldest segments while the log is over its
+// size cap. The segment being replayed is left alone.
+func (c *Client) enforceSizeLocked() {
+	for c.size > c.maxBytes && len(c.segments) > 0 {
+		i := 0
+		if c.segments[0] == c.replaying {
+			if len(c.segments) == 1 {
+				return
+			}
+			i = 1
+		}
+		seg := c.segments[i]
+		if i == len(c.segments)-1 {
+			_ = c.closeActiveLocked()
+		}
+		c.removeLocked(seg)
+		c.discarded(seg.records-seg.replayed, "size")
+	}
+}
+
+func (c *Client) removeLocked(seg *segment) {
+	for i, s := range c.segments {
+		if s == seg {
+			c.segments = append(c.segments[:i], c.segments[i+1:]...)
+			break
+		}
+	}
+	c.size -= seg.size - seg.offset
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		otel.Handle(fmt.Errorf("failed to remove spool segment: %w", err))
+	}
+}
+
+func (c *Client) discarded(n int, reason string) {
+	if n <= 0 {
+		return
+	}
+	c.batches.Add(context.Background(), int64(n), metric.WithAttributes(
+		attribute.String("outcome", "discarded"),
+		attribute.String("reason", reason),
+	))
+}
+
+func (c *Client) run(ctx context.Context) {
+	defer close(c.done)
+	ticker := time.NewTicker(c.retryInterval)
+	defer ticker.Stop()
+	for {
+		c.replay(ctx)
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replay sends the spooled segments, oldest first, until the log is empty
+// or an upload fails with a retryable error.
+func (c *Client) replay(ctx context.Context) {
+	for ctx.Err() == nil {
+		seg := c.nextReplay()
+		if seg == nil {
+			return
+		}
+		err := c.replaySegment(ctx, seg)
+
+		c.mu.Lock()
+		c.replaying = nil
+		if err == nil {
+			c.removeLocked(seg)
+		}
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// nextReplay picks the oldest segment, closing it first if it is the one
+// being written so that new batches go to a fresh segment.
+func (c *Client) nextReplay() *segment {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.segments) == 0 {
+		return nil
+	}
+	if len(c.segments) == 1 && c.active != nil {
+		if err := c.closeActiveLocked(); err != nil {
+			otel.Handle(fmt.Errorf("failed to close spool segment: %w", err))
+			return nil
+		}
+	}
+	c.replaying = c.segments[0]
+	return c.replaying
+}
+
+func (c *Client) replaySegment(ctx context.Context, seg *segment) error {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(seg.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		ts, payload, err := readRecord(r, c.maxBytes)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// Only the torn tail of a crashed run can be corrupt, and it
+			// was cut off on load; anything else is damage on disk.
+			c.discarded(seg.records-seg.replayed, "corrupt")
+			return nil
+		}
+		n := int64(headerSize + len(payload))
+
+		var req coltracepb.ExportTraceServiceRequest
+		switch {
+		case time.Since(ts) > c.maxAge:
+			c.discarded(1, "age")
+		case proto.Unmarshal(payload, &req) != nil:
+			c.discarded(1, "corrupt")
+		default:
+			err := c.upload(ctx, req.ResourceSpans)
+			switch {
+			case err == nil:
+				c.batches.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "replayed")))
+			case ctx.Err() != nil || retryable(err):
+				return err
+			default:
+				// Leaving the batch at the head of the log would hold
+				// back every later one until it ages out.
+				otel.Handle(fmt.Errorf("dropping spooled spans rejected by the collector: %w", err))
+				c.discarded(1, "rejected")
+			}
+		}
+
+		c.mu.Lock()
+		seg.offset += n
+		seg.replayed++
+		c.size -= n
+		c.mu.Unlock()
+	}
+}
+
+func (c *Client) upload(ctx context.Context, spans []*tracepb.ResourceSpans) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultUploadTimeout)
+	defer cancel()
+	return c.next.UploadTraces(ctx, spans)
+}
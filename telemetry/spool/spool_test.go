@@ -0,0 +1,296 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClient fails every upload while down is set, and rejects the batches
+// named in reject as invalid. Batches are named by their schema URL.
+type fakeClient struct {
+	down     atomic.Bool
+	uploaded atomic.Int64
+
+	mu     sync.Mutex
+	names  []string
+	reject map[string]bool
+}
+
+func (c *fakeClient) Start(context.Context) error { return nil }
+func (c *fakeClient) Stop(context.Context) error  { return nil }
+
+func (c *fakeClient) UploadTraces(_ context.Context, spans []*tracepb.ResourceSpans) error {
+	if c.down.Load() {
+		return status.Error(codes.Unavailable, "collector unavailable")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reject[spans[0].SchemaUrl] {
+		return status.Error(codes.InvalidArgument, "invalid batch")
+	}
+	c.uploaded.Add(1)
+	c.names = append(c.names, spans[0].SchemaUrl)
+	return nil
+}
+
+func (c *fakeClient) received() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.names)
+}
+
+func batch(name string) []*tracepb.ResourceSpans {
+	return []*tracepb.ResourceSpans{{SchemaUrl: name}}
+}
+
+// spoolAll uploads one batch per name and fails unless each is spooled.
+func spoolAll(t *testing.T, c *Client, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := c.UploadTraces(context.Background(), batch(name)); !errors.Is(err, ErrSpooled) {
+			t.Fatalf("UploadTraces(%s) = %v, want ErrSpooled", name, err)
+		}
+	}
+}
+
+// replayed starts c and waits until the spool is empty, then returns the
+// batches next received.
+func replayed(t *testing.T, c *Client, next *fakeClient) []string {
+	t.Helper()
+	ctx := context.Background()
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Stop(ctx) })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.backlogged() {
+		if time.Now().After(deadline) {
+			t.Fatalf("spool not drained, %d batches received", next.uploaded.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return next.received()
+}
+
+func TestUploadTracesSpooled(t *testing.T) {
+	next := &fakeClient{}
+	c, err := New(next, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop(ctx)
+
+	if err := c.UploadTraces(ctx, batch("a")); err != nil {
+		t.Fatalf("UploadTraces() = %v, want nil while the collector is up", err)
+	}
+	next.down.Store(true)
+	if err := c.UploadTraces(ctx, batch("b")); !errors.Is(err, ErrSpooled) {
+		t.Fatalf("UploadTraces() = %v, want ErrSpooled while the collector is down", err)
+	}
+	// Earlier batches are still on disk, so this one is spooled behind them.
+	next.down.Store(false)
+	if err := c.UploadTraces(ctx, batch("c")); !errors.Is(err, ErrSpooled) {
+		t.Fatalf("UploadTraces() = %v, want ErrSpooled while the spool is backlogged", err)
+	}
+	if got := next.uploaded.Load(); got != 1 {
+		t.Errorf("%d batches uploaded, want 1", got)
+	}
+}
+
+func TestReplayInOrder(t *testing.T) {
+	next := &fakeClient{}
+	next.down.Store(true)
+	c, err := New(next, t.TempDir(), WithRetryInterval(10*time.Millisecond), WithSegmentBytes(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spoolAll(t, c, "1", "2", "3", "4")
+
+	next.down.Store(false)
+	if got, want := replayed(t, c, next), []string{"1", "2", "3", "4"}; !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+	if err := c.UploadTraces(context.Background(), batch("5")); err != nil {
+		t.Errorf("UploadTraces() = %v after replay, want nil", err)
+	}
+}
+
+func TestMaxBytesDropsOldest(t *testing.T) {
+	next := &fakeClient{}
+	next.down.Store(true)
+	// Each record is the 16 byte header plus a 6 byte payload, so the cap
+	// holds three of them.
+	c, err := New(next, t.TempDir(), WithRetryInterval(10*time.Millisecond), WithMaxBytes(80))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i := range 10 {
+		names = append(names, fmt.Sprintf("b%d", i))
+	}
+	spoolAll(t, c, names...)
+	if c.size > c.maxBytes {
+		t.Errorf("spool holds %d bytes, want at most %d", c.size, c.maxBytes)
+	}
+
+	next.down.Store(false)
+	got := replayed(t, c, next)
+	if want := names[len(names)-len(got):]; len(got) == 0 || !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want the newest batches %v", got, want)
+	}
+}
+
+func TestMaxAgeDropsOld(t *testing.T) {
+	next := &fakeClient{}
+	next.down.Store(true)
+	c, err := New(next, t.TempDir(), WithRetryInterval(10*time.Millisecond), WithMaxAge(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spoolAll(t, c, "old")
+	time.Sleep(100 * time.Millisecond)
+	spoolAll(t, c, "new")
+
+	next.down.Store(false)
+	if got, want := replayed(t, c, next), []string{"new"}; !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+}
+
+func TestTornTailTruncated(t *testing.T) {
+	dir := t.TempDir()
+	next := &fakeClient{}
+	next.down.Store(true)
+	c, err := New(next, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spoolAll(t, c, "1", "2")
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Half a record, as a crash in the middle of a write would leave it.
+	path := segmentPath(dir, 0)
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torn := encodeRecord(time.Now(), []byte("torn"))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(torn[:len(torn)/2]); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	c, err = New(next, dir, WithRetryInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() != fi.Size() {
+		t.Errorf("segment is %d bytes after load, want %d", after.Size(), fi.Size())
+	}
+	next.down.Store(false)
+	if got, want := replayed(t, c, next), []string{"1", "2"}; !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix)); len(matches) != 0 {
+		t.Errorf("segments left after replay: %v", matches)
+	}
+}
+
+func TestRejectedBatchDropped(t *testing.T) {
+	next := &fakeClient{reject: map[string]bool{"bad": true}}
+	next.down.Store(true)
+	c, err := New(next, t.TempDir(), WithRetryInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spoolAll(t, c, "1", "bad", "2")
+
+	next.down.Store(false)
+	if got, want := replayed(t, c, next), []string{"1", "2"}; !slices.Equal(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+
+	// Rejected outright, the batch is not worth spooling either.
+	err = c.UploadTraces(context.Background(), batch("bad"))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("UploadTraces() = %v, want the InvalidArgument error", err)
+	}
+	if c.backlogged() {
+		t.Error("rejected batch was spooled")
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{status.Error(codes.Unavailable, ""), true},
+		{status.Error(codes.DeadlineExceeded, ""), true},
+		{status.Error(codes.ResourceExhausted, ""), true},
+		{status.Error(codes.InvalidArgument, ""), false},
+		{fmt.Errorf("export: %w", status.Error(codes.Unavailable, "")), true},
+		{context.DeadlineExceeded, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{&httpError{code: 503}, true},
+		{&httpError{code: 429}, true},
+		{&httpError{code: 400}, false},
+		{&httpError{code: 413}, false},
+		{errors.New("retry-able request failure: 502 Bad Gateway"), true},
+		{errors.New("failed to send to http://collector/v1/traces: 400 Bad Request"), false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+type httpError struct{ code int }
+
+func (e *httpError) Error() string       { return fmt.Sprintf("status %d", e.code) }
+func (e *httpError) HTTPStatusCode() int { return e.code }
+
+func TestStopTwice(t *testing.T) {
+	c, err := New(&fakeClient{}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := c.Stop(ctx); err != nil {
+			t.Fatalf("Stop() = %v", err)
+		}
+	}
+}
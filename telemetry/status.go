@@ -0,0 +1,168 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// pipelineStatus describes the telemetry pipeline of the process: the
+// sampler, the state of every span exporter and the errors reported by the
+// SDK. It is served as JSON at /debug/telemetry and exported as metrics.
+//
+// It is also the global OpenTelemetry error handler, so that export
+// failures and dropped data are logged instead of vanishing. They are
+// written straight to stderr: through the default logger they could be
+// queued into the very log exporter that is failing.
+type pipelineStatus struct {
+	service   string
+	log       *slog.Logger
+	sampler   *dynamicSampler
+	exporters []*exporterStats
+
+	errors      atomic.Int64
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func newPipelineStatus(service string) *pipelineStatus {
+	return &pipelineStatus{service: service, log: slog.New(newFallbackLogHandler())}
+}
+
+// Handle implements otel.ErrorHandler.
+func (s *pipelineStatus) Handle(err error) {
+	if err == nil {
+		return
+	}
+	s.errors.Add(1)
+	s.mu.Lock()
+	s.lastError, s.lastErrorAt = err.Error(), time.Now()
+	s.mu.Unlock()
+	s.log.Error("telemetry error", "error", err)
+}
+
+// registerMetrics reports the exporter counters as observable instruments.
+// The export latency is recorded by each exporter as it happens.
+func (s *pipelineStatus) registerMetrics() error {
+	meter := otel.Meter("telemetry")
+	queueSize, err := meter.Int64ObservableUpDownCounter("otel.exporter.span.queue.size",
+		metric.WithDescription("Spans waiting in the batch processor queue of an exporter."),
+		metric.WithUnit("{span}"))
+	if err != nil {
+		return err
+	}
+	queueCapacity, err := meter.Int64ObservableUpDownCounter("otel.exporter.span.queue.capacity",
+		metric.WithDescription("Maximum number of spans the batch processor queue of an exporter holds."),
+		metric.WithUnit("{span}"))
+	if err != nil {
+		return err
+	}
+	spans, err := meter.Int64ObservableCounter("otel.exporter.spans",
+		metric.WithDescription("Spans handled by an exporter, by outcome: exported, spooled to disk, failed or dropped because the queue was full."),
+		metric.WithUnit("{span}"))
+	if err != nil {
+		return err
+	}
+	errs, err := meter.Int64ObservableCounter("otel.errors",
+		metric.WithDescription("Errors reported by the OpenTelemetry SDK and exporters."),
+		metric.WithUnit("{error}"))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, e := range s.exporters {
+			name := attribute.String("exporter", e.exporter)
+			o.ObserveInt64(queueSize, e.pending.Load(), metric.WithAttributes(name))
+			o.ObserveInt64(queueCapacity, e.capacity, metric.WithAttributes(name))
+			o.ObserveInt64(spans, e.exported.Load(), metric.WithAttributes(name, attribute.String("outcome", "exported")))
+			o.ObserveInt64(spans, e.spooled.Load(), metric.WithAttributes(name, attribute.String("outcome", "spooled")))
+			o.ObserveInt64(spans, e.failed.Load(), metric.WithAttributes(name, attribute.String("outcome", "failed")))
+			o.ObserveInt64(spans, e.rejected.Load(), metric.WithAttributes(name, attribute.String("outcome", "dropped")))
+		}
+		o.ObserveInt64(errs, s.errors.Load())
+		return nil
+	}, queueSize, queueCapacity, spans, errs)
+	return err
+}
+
+type statusJSON struct {
+	Service       string               `json:"service"`
+	Sampler       string               `json:"sampler"`
+	SpanExporters []exporterStatusJSON `json:"span_exporters"`
+	Errors        int64                `json:"errors"`
+	LastError     string               `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time           `json:"last_error_at,omitempty"`
+}
+
+type exporterStatusJSON struct {
+	Name               string     `json:"name"`
+	QueueSize          int64      `json:"queue_size"`
+	QueueCapacity      int64      `json:"queue_capacity"`
+	Exported           int64      `json:"exported"`
+	Spooled            int64      `json:"spooled"`
+	Failed             int64      `json:"failed"`
+	Dropped            int64      `json:"dropped"`
+	LastExportAt       *time.Time `json:"last_export_at,omitempty"`
+	LastExportDuration string     `json:"last_export_duration,omitempty"`
+	LastError          string     `json:"last_error,omitempty"`
+	LastErrorAt        *time.Time `json:"last_error_at,omitempty"`
+}
+
+func (s *pipelineStatus) snapshot() statusJSON {
+	out := statusJSON{
+		Service:       s.service,
+		SpanExporters: []exporterStatusJSON{},
+		Errors:        s.errors.Load(),
+	}
+	if s.sampler != nil {
+		out.Sampler = s.sampler.Description()
+	}
+	s.mu.Lock()
+	out.LastError, out.LastErrorAt = s.lastError, timeOrNil(s.lastErrorAt)
+	s.mu.Unlock()
+
+	for _, e := range s.exporters {
+		es := exporterStatusJSON{
+			Name:          e.exporter,
+			QueueSize:     e.pending.Load(),
+			QueueCapacity: e.capacity,
+			Exported:      e.exported.Load(),
+			Spooled:       e.spooled.Load(),
+			Failed:        e.failed.Load(),
+			Dropped:       e.rejected.Load(),
+		}
+		e.mu.Lock()
+		es.LastExportAt = timeOrNil(e.lastExport)
+		if !e.lastExport.IsZero() {
+			es.LastExportDuration = e.lastDuration.String()
+		}
+		es.LastError, es.LastErrorAt = e.lastError, timeOrNil(e.lastErrorAt)
+		e.mu.Unlock()
+		out.SpanExporters = append(out.SpanExporters, es)
+	}
+	return out
+}
+
+func (s *pipelineStatus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(s.snapshot())
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,104 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func getStatus(t *testing.T, s *pipelineStatus) statusJSON {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/debug/telemetry", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var got statusJSON
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestPipelineStatus(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+
+	exp := &errExporter{}
+	counting := newCountingExporter("otlp", exp)
+	s := newPipelineStatus("service-t")
+	s.sampler = newDynamicSampler("always_on", "", sdktrace.AlwaysSample())
+	s.exporters = append(s.exporters, counting.counts)
+	if err := s.registerMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	export := func(n int) {
+		spans := make(tracetest.SpanStubs, n).Snapshots()
+		counting.counts.pending.Add(int64(n))
+		if err := counting.ExportSpans(context.Background(), spans); err != nil {
+			s.Handle(err)
+		}
+	}
+
+	export(3)
+	got := getStatus(t, s)
+	if got.Service != "service-t" || got.Sampler != "AlwaysOnSampler" || got.Errors != 0 || got.LastError != "" {
+		t.Errorf("status after a successful export = %+v", got)
+	}
+	if len(got.SpanExporters) != 1 {
+		t.Fatalf("span_exporters = %+v, want one", got.SpanExporters)
+	}
+	e := got.SpanExporters[0]
+	if e.Name != "otlp" || e.Exported != 3 || e.Failed != 0 || e.QueueSize != 0 || e.LastExportAt == nil || e.LastError != "" {
+		t.Errorf("exporter after a successful export = %+v", e)
+	}
+
+	exp.err = errors.New("connection refused")
+	export(2)
+	got = getStatus(t, s)
+	e = got.SpanExporters[0]
+	if e.Exported != 3 || e.Failed != 2 || e.LastError != "connection refused" || e.LastErrorAt == nil {
+		t.Errorf("exporter after a failed export = %+v", e)
+	}
+	if got.Errors != 1 || got.LastError != "otlp exporter: connection refused" || got.LastErrorAt == nil {
+		t.Errorf("errors after a failed export = %d, %q", got.Errors, got.LastError)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, dp := range sum.DataPoints {
+					values[m.Name+"{"+dp.Attributes.Encoded(attribute.DefaultEncoder())+"}"] = dp.Value
+				}
+			}
+		}
+	}
+	for key, want := range map[string]int64{
+		"otel.exporter.spans{exporter=otlp,outcome=exported}": 3,
+		"otel.exporter.spans{exporter=otlp,outcome=failed}":   2,
+		"otel.exporter.spans{exporter=otlp,outcome=dropped}":  0,
+		"otel.exporter.span.queue.size{exporter=otlp}":        0,
+		"otel.exporter.span.queue.capacity{exporter=otlp}":    counting.counts.capacity,
+		"otel.errors{}": 1,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s = %d (recorded %v), want %d", key, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package tailsampling
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Policy keeps a trace when Match returns true for any of its spans.
+type Policy struct {
+	Name  string
+	Match func(sdktrace.ReadOnlySpan) bool
+}
+
+// ErrorPolicy keeps traces containing a span with status codes.Error, such
+// as the ones marked by service-e's GraphQL interceptor.
+func ErrorPolicy() Policy {
+	return Policy{
+		Name: "error",
+		Match: func(s sdktrace.ReadOnlySpan) bool {
+			return s.Status().Code == codes.Error
+		},
+	}
+}
+
+// LatencyPolicy keeps traces containing a span that took longer than
+// threshold.
+func LatencyPolicy(threshold time.Duration) Policy {
+	return Policy{
+		Name: "latency",
+		Match: func(s sdktrace.ReadOnlySpan) bool {
+			return s.EndTime().Sub(s.StartTime()) > threshold
+		},
+	}
+}
+
+// AttributePolicy keeps traces containing a span with the given attribute
+// value.
+func AttributePolicy(kv attribute.KeyValue) Policy {
+	return Policy{
+		Name: "attribute:" + string(kv.Key),
+		Match: func(s sdktrace.ReadOnlySpan) bool {
+			for _, attr := range s.Attributes() {
+				if attr.Key == kv.Key && attr.Value == kv.Value {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+type config struct {
+	policies     []Policy
+	ratio        float64
+	maxTraces    int
+	maxSpans     int
+	decisionWait time.Duration
+}
+
+// Option configures a Processor.
+type Option func(*config)
+
+// WithPolicies adds policies that keep a trace unconditionally.
+func WithPolicies(policies ...Policy) Option {
+	return func(c *config) {
+		c.policies = append(c.policies, policies...)
+	}
+}
+
+// WithSamplingRatio sets the probability of keeping a trace that matches no
+// policy. It defaults to 0.
+func WithSamplingRatio(ratio float64) Option {
+	return func(c *config) {
+		c.ratio = min(max(ratio, 0), 1)
+	}
+}
+
+// WithMaxTraces bounds the number of traces waiting for a decision. When
+// exceeded, the oldest trace is decided with the spans received so far.
+func WithMaxTraces(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.maxTraces = n
+		}
+	}
+}
+
+// WithMaxSpans bounds the number of spans buffered across all traces.
+func WithMaxSpans(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.maxSpans = n
+		}
+	}
+}
+
+// WithDecisionWait sets how long a trace may wait for its local root span
+// before being decided anyway.
+func WithDecisionWait(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.decisionWait = d
+		}
+	}
+}
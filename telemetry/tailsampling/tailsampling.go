@@ -0,0 +1,306 @@
+// Package tailsampling provides a span processor that decides whether to
+// keep a trace after its local root span has ended, when errors and
+// latencies are known.
+package tailsampling
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultMaxTraces    = 10000
+	defaultMaxSpans     = 100000
+	defaultDecisionWait = 30 * time.Second
+)
+
+// Processor buffers the spans of each trace until its local root span ends
+// and then forwards the whole trace to the next processor if any Policy
+// matches one of its spans. Traces matching no policy are kept with the
+// configured probability, derived from the trace ID so that every service
+// using the same ratio reaches the same decision.
+//
+// Spans of a trace that was dropped, such as those of a second call into
+// the service, are buffered again: if a policy matches them, they are kept
+// even though the earlier spans were not.
+type Processor struct {
+	next         sdktrace.SpanProcessor
+	policies     []Policy
+	threshold    uint64
+	maxTraces    int
+	maxSpans     int
+	decisionWait time.Duration
+
+	mu      sync.Mutex
+	pending map[trace.TraceID]*pendingTrace
+	order   *list.List
+	spans   int
+	decided map[trace.TraceID]bool
+	recent  []trace.TraceID
+	traces  metric.Int64Counter
+
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+type pendingTrace struct {
+	spans    []sdktrace.ReadOnlySpan
+	received time.Time
+	elem     *list.Element
+}
+
+var _ sdktrace.SpanProcessor = (*Processor)(nil)
+
+// New returns a Processor forwarding kept traces to next, typically a batch
+// span processor wrapping an exporter.
+func New(next sdktrace.SpanProcessor, opts ...Option) *Processor {
+	cfg := config{
+		maxTraces:    defaultMaxTraces,
+		maxSpans:     defaultMaxSpans,
+		decisionWait: defaultDecisionWait,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	p := &Processor{
+		next:         next,
+		policies:     cfg.policies,
+		threshold:    uint64(cfg.ratio * (1 << 63)),
+		maxTraces:    cfg.maxTraces,
+		maxSpans:     cfg.maxSpans,
+		decisionWait: cfg.decisionWait,
+		pending:      make(map[trace.TraceID]*pendingTrace),
+		order:        list.New(),
+		decided:      make(map[trace.TraceID]bool),
+		stop:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+
+	meter := otel.Meter("telemetry/tailsampling")
+	p.traces, _ = meter.Int64Counter("otel.tailsampling.traces",
+		metric.WithDescription("Traces evaluated by the tail sampling processor, by decision and reason."),
+		metric.WithUnit("{trace}"))
+	_, _ = meter.Int64ObservableGauge("otel.tailsampling.buffered_spans",
+		metric.WithDescription("Spans waiting for a tail sampling decision."),
+		metric.WithUnit("{span}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			o.Observe(int64(p.spans))
+			return nil
+		}))
+
+	go p.evictLoop()
+	return p
+}
+
+// OnStart forwards the span to the next processor.
+func (p *Processor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+// OnEnd buffers s and decides its trace once the local root has ended.
+func (p *Processor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	id := s.SpanContext().TraceID()
+
+	p.mu.Lock()
+	if p.decided[id] {
+		// Late span of a kept trace. Spans of a dropped trace are buffered
+		// again, so that policies can still keep them.
+		p.mu.Unlock()
+		p.next.OnEnd(s)
+		return
+	}
+
+	t, ok := p.pending[id]
+	if !ok {
+		t = &pendingTrace{received: time.Now()}
+		t.elem = p.order.PushBack(id)
+		p.pending[id] = t
+	}
+	t.spans = append(t.spans, s)
+	p.spans++
+
+	var ready []decision
+	if isLocalRoot(s) {
+		ready = append(ready, p.decideLocked(id, ""))
+	}
+	ready = append(ready, p.evictLocked(time.Now())...)
+	p.mu.Unlock()
+
+	p.forward(ready)
+}
+
+// ForceFlush decides the pending traces that are complete or have waited
+// longer than the decision wait, and flushes the next processor. A trace
+// still in progress stays buffered, so that a span failing after the flush
+// can still keep it; only Shutdown decides those.
+func (p *Processor) ForceFlush(ctx context.Context) error {
+	p.mu.Lock()
+	ready := p.evictLocked(time.Now())
+	for e := p.order.Front(); e != nil; {
+		id := e.Value.(trace.TraceID)
+		e = e.Next()
+		// Late spans of a dropped trace, whose local root has ended.
+		if _, ok := p.decided[id]; ok {
+			ready = append(ready, p.decideLocked(id, "flush"))
+		}
+	}
+	p.mu.Unlock()
+	p.forward(ready)
+	return p.next.ForceFlush(ctx)
+}
+
+// Shutdown stops the eviction of timed out traces, decides every pending
+// trace and shuts down the next processor.
+func (p *Processor) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		<-p.stopped
+	})
+	p.flushPending()
+	return p.next.Shutdown(ctx)
+}
+
+// evictLoop decides the traces that have waited longer than the decision
+// wait, so that an idle service does not hold them until the next span
+// ends. A trace is decided at most half the decision wait late.
+func (p *Processor) evictLoop() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(p.decisionWait / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			ready := p.evictLocked(now)
+			p.mu.Unlock()
+			p.forward(ready)
+		}
+	}
+}
+
+func (p *Processor) flushPending() {
+	p.mu.Lock()
+	var ready []decision
+	for p.order.Len() > 0 {
+		ready = append(ready, p.decideLocked(p.order.Front().Value.(trace.TraceID), "shutdown"))
+	}
+	p.mu.Unlock()
+	p.forward(ready)
+}
+
+type decision struct {
+	keep  bool
+	spans []sdktrace.ReadOnlySpan
+}
+
+// decideLocked removes the trace from the buffer and evaluates the
+// policies. A non-empty cause records why the decision was forced early.
+func (p *Processor) decideLocked(id trace.TraceID, cause string) decision {
+	t := p.pending[id]
+	delete(p.pending, id)
+	p.order.Remove(t.elem)
+	p.spans -= len(t.spans)
+
+	keep, reason := p.evaluate(id, t.spans)
+	_, redecided := p.decided[id]
+	p.rememberLocked(id, keep)
+	if redecided && !keep {
+		// Still dropped: the trace was counted the first time.
+		return decision{spans: t.spans}
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.Bool("kept", keep),
+		attribute.String("reason", reason),
+	}
+	if cause != "" {
+		attrs = append(attrs, attribute.String("forced_by", cause))
+	}
+	if redecided {
+		attrs = append(attrs, attribute.Bool("upgraded", true))
+	}
+	p.traces.Add(context.Background(), 1, metric.WithAttributes(attrs...))
+
+	return decision{keep: keep, spans: t.spans}
+}
+
+func (p *Processor) evaluate(id trace.TraceID, spans []sdktrace.ReadOnlySpan) (bool, string) {
+	for _, policy := range p.policies {
+		for _, s := range spans {
+			if policy.Match(s) {
+				return true, policy.Name
+			}
+		}
+	}
+	if binary.BigEndian.Uint64(id[8:16])>>1 < p.threshold {
+		return true, "probabilistic"
+	}
+	return false, "no_match"
+}
+
+// evictLocked forces a decision on traces that exceed the buffer limits or
+// have waited longer than the decision wait, oldest first.
+func (p *Processor) evictLocked(now time.Time) []decision {
+	var ready []decision
+	for p.order.Len() > 0 {
+		oldest := p.order.Front().Value.(trace.TraceID)
+		switch {
+		case len(p.pending) > p.maxTraces, p.spans > p.maxSpans:
+			ready = append(ready, p.decideLocked(oldest, "buffer_full"))
+		case now.Sub(p.pending[oldest].received) > p.decisionWait:
+			ready = append(ready, p.decideLocked(oldest, "timeout"))
+		default:
+			return ready
+		}
+	}
+	return ready
+}
+
+// rememberLocked keeps the most recent decisions so that spans ending after
+// their local root follow the same decision.
+func (p *Processor) rememberLocked(id trace.TraceID, keep bool) {
+	if _, ok := p.decided[id]; ok {
+		p.decided[id] = keep
+		return
+	}
+	p.decided[id] = keep
+	p.recent = append(p.recent, id)
+	if len(p.recent) > p.maxTraces {
+		delete(p.decided, p.recent[0])
+		p.recent = p.recent[1:]
+	}
+}
+
+func (p *Processor) forward(ready []decision) {
+	for _, d := range ready {
+		if !d.keep {
+			continue
+		}
+		for _, s := range d.spans {
+			p.next.OnEnd(s)
+		}
+	}
+}
+
+func isLocalRoot(s sdktrace.ReadOnlySpan) bool {
+	parent := s.Parent()
+	return !parent.IsValid() || parent.IsRemote()
+}
@@ -0,0 +1,243 @@
+package tailsampling
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTracer(t *testing.T, opts ...Option) (trace.Tracer, *tracetest.SpanRecorder) {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(New(rec, opts...)))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return tp.Tracer("test"), rec
+}
+
+// remoteParent returns a context continuing a sampled trace started in
+// another service.
+func remoteParent() context.Context {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x01},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	return trace.ContextWithRemoteSpanContext(context.Background(), sc)
+}
+
+func names(spans []sdktrace.ReadOnlySpan) []string {
+	out := make([]string, len(spans))
+	for i, s := range spans {
+		out[i] = s.Name()
+	}
+	return out
+}
+
+func TestTimedOutTraceDecidedWhileIdle(t *testing.T) {
+	tracer, rec := newTracer(t, WithPolicies(ErrorPolicy()), WithDecisionWait(50*time.Millisecond))
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	defer root.End()
+	_, child := tracer.Start(ctx, "child")
+	child.SetStatus(codes.Error, "failed")
+	child.End()
+
+	// The root never ends and no other span does: only the eviction
+	// ticker can decide the trace.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rec.Ended()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out trace was not decided")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := names(rec.Ended()); len(got) != 1 || got[0] != "child" {
+		t.Errorf("forwarded spans = %v, want [child]", got)
+	}
+}
+
+func TestErrorUpgradesDroppedTrace(t *testing.T) {
+	tracer, rec := newTracer(t, WithPolicies(ErrorPolicy()))
+	ctx := remoteParent()
+
+	_, first := tracer.Start(ctx, "first call")
+	first.End()
+	if got := rec.Ended(); len(got) != 0 {
+		t.Fatalf("forwarded %v, want the first call dropped", names(got))
+	}
+
+	_, second := tracer.Start(ctx, "second call")
+	second.SetStatus(codes.Error, "failed")
+	second.End()
+
+	_, third := tracer.Start(ctx, "third call")
+	third.End()
+
+	got := names(rec.Ended())
+	if len(got) != 2 || got[0] != "second call" || got[1] != "third call" {
+		t.Errorf("forwarded spans = %v, want [second call third call]", got)
+	}
+}
+
+func TestForceFlushKeepsTraceInProgress(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(New(rec, WithPolicies(ErrorPolicy()))))
+	defer tp.Shutdown(context.Background())
+	tracer := tp.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, ok := tracer.Start(ctx, "ok")
+	ok.End()
+	if err := tp.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Ended(); len(got) != 0 {
+		t.Fatalf("forwarded %v on flush, want the trace in progress kept back", names(got))
+	}
+
+	// The error ends after the flush: a trace decided by the flush would
+	// have been dropped.
+	_, failed := tracer.Start(ctx, "failed")
+	failed.SetStatus(codes.Error, "failed")
+	failed.End()
+	root.End()
+	if got := names(rec.Ended()); len(got) != 3 {
+		t.Errorf("forwarded spans = %v, want [ok failed root]", got)
+	}
+}
+
+func TestForceFlushDecidesLateSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(New(rec, WithPolicies(ErrorPolicy()))))
+	defer tp.Shutdown(context.Background())
+	tracer := tp.Tracer("test")
+
+	// The root of the trace ends first and the trace is dropped, then a
+	// span outliving it fails.
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, late := tracer.Start(ctx, "late")
+	root.End()
+	late.SetStatus(codes.Error, "failed")
+	late.End()
+	if got := rec.Ended(); len(got) != 0 {
+		t.Fatalf("forwarded %v before the flush", names(got))
+	}
+
+	if err := tp.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(rec.Ended()); len(got) != 1 || got[0] != "late" {
+		t.Errorf("forwarded spans = %v, want [late]", got)
+	}
+}
+
+// startTraces starts n traces whose roots stay open, each with children
+// ended spans named after the trace.
+func startTraces(tracer trace.Tracer, n, children int) []trace.Span {
+	var roots []trace.Span
+	for i := range n {
+		ctx, root := tracer.Start(context.Background(), "root")
+		for range children {
+			_, child := tracer.Start(ctx, string(rune('a'+i)))
+			child.End()
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+func TestMaxTracesEvictsOldest(t *testing.T) {
+	// Every trace is kept once decided, so the forwarded spans are the
+	// evicted ones.
+	tracer, rec := newTracer(t, WithSamplingRatio(1), WithMaxTraces(2))
+	roots := startTraces(tracer, 3, 1)
+	defer func() {
+		for _, root := range roots {
+			root.End()
+		}
+	}()
+
+	if got := names(rec.Ended()); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("forwarded spans = %v, want [a] from the oldest trace", got)
+	}
+}
+
+func TestMaxSpansEvictsOldest(t *testing.T) {
+	tracer, rec := newTracer(t, WithSamplingRatio(1), WithMaxSpans(5))
+	roots := startTraces(tracer, 3, 2)
+	defer func() {
+		for _, root := range roots {
+			root.End()
+		}
+	}()
+
+	// The sixth span goes over the bound: the oldest trace makes room.
+	if got := names(rec.Ended()); !reflect.DeepEqual(got, []string{"a", "a"}) {
+		t.Errorf("forwarded spans = %v, want [a a] from the oldest trace", got)
+	}
+}
+
+func TestDecisionCounter(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+
+	tracer, _ := newTracer(t, WithPolicies(ErrorPolicy()), WithMaxTraces(1))
+	_, failed := tracer.Start(context.Background(), "failed")
+	failed.SetStatus(codes.Error, "failed")
+	failed.End()
+	_, ok := tracer.Start(context.Background(), "ok")
+	ok.End()
+	// The first of two traces in progress is evicted.
+	roots := startTraces(tracer, 2, 1)
+	defer func() {
+		for _, root := range roots {
+			root.End()
+		}
+	}()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "otel.tailsampling.traces" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				got[dp.Attributes.Encoded(attribute.DefaultEncoder())] = dp.Value
+			}
+		}
+	}
+	want := map[string]int64{
+		"kept=true,reason=error":                           1,
+		"kept=false,reason=no_match":                       1,
+		"forced_by=buffer_full,kept=false,reason=no_match": 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("otel.tailsampling.traces = %v, want %v", got, want)
+	}
+}
+
+func TestShutdownTwice(t *testing.T) {
+	p := New(tracetest.NewSpanRecorder())
+	for range 2 {
+		if err := p.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Package telemetry bootstraps the OpenTelemetry SDK shared by every service
+// in the example: it builds the tracer, meter and logger providers, registers
+// them globally and hands back a single shutdown function.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"telemetry/baggageattr"
+	"telemetry/tailsampling"
+	"telemetry/zpages"
+)
+
+// Setup builds the TracerProvider, MeterProvider and LoggerProvider described
+// by opts and installs them as the global providers. The returned function
+// flushes and shuts down all of them, logging how many spans each exporter
+// delivered or dropped; it must be called before the process exits.
+func Setup(ctx context.Context, opts ...Option) (func(context.Context) error, error) {
+	cfg := newConfig(opts...)
+
+	var shutdownFuncs []func(context.Context) error
+	shutdown := func(ctx context.Context) error {
+		var err error
+		for i := len(shutdownFuncs) - 1; i >= 0; i-- {
+			err = errors.Join(err, shutdownFuncs[i](ctx))
+		}
+		shutdownFuncs = nil
+		return err
+	}
+	fail := func(err error) (func(context.Context) error, error) {
+		return nil, errors.Join(err, shutdown(ctx))
+	}
+
+	status := newPipelineStatus(cfg.serviceName)
+	otel.SetErrorHandler(status)
+
+	prop, err := propagatorFromEnv()
+	if err != nil {
+		return fail(err)
+	}
+
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create resource: %w", err))
+	}
+
+	admin := newAdminServer(cfg.adminAddr)
+	admin.Handle("GET /debug/telemetry", status)
+
+	runtimeMetrics, err := runtimeMetricsEnabled(cfg)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Before the tracer provider, so that it shuts down after it: the
+	// final flush of the spans records export metrics too.
+	mp, err := newMeterProvider(ctx, cfg, res, admin, runtimeProducers(runtimeMetrics))
+	if err != nil {
+		return fail(err)
+	}
+	shutdownFuncs = append(shutdownFuncs, named("meter provider", mp.Shutdown))
+	otel.SetMeterProvider(mp)
+
+	tp, err := newTracerProvider(ctx, cfg, res, status, admin)
+	if err != nil {
+		return fail(err)
+	}
+	// Reported once tp.Shutdown has flushed every batch processor.
+	for _, c := range status.exporters {
+		shutdownFuncs = append(shutdownFuncs, c.report)
+	}
+	shutdownFuncs = append(shutdownFuncs, named("tracer provider", tp.Shutdown))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(prop)
+
+	rc := newReconfigurer(cfg, status.sampler)
+	if rc.token != "" {
+		admin.Handle("GET /config", rc)
+		admin.Handle("PUT /config", rc)
+	}
+
+	if err := status.registerMetrics(); err != nil {
+		return fail(fmt.Errorf("failed to register telemetry metrics: %w", err))
+	}
+	if runtimeMetrics {
+		if err := startRuntimeMetrics(mp); err != nil {
+			return fail(err)
+		}
+	}
+
+	level, err := parseLogLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		return fail(fmt.Errorf("invalid LOG_LEVEL: %w", err))
+	}
+	logLevel.Set(level)
+
+	lp, otlpLogs, consoleLogs, err := newLoggerProvider(ctx, cfg, res)
+	if err != nil {
+		return fail(err)
+	}
+	// Runs after lp.Shutdown: anything logged once the providers are gone,
+	// such as a shutdown error, still reaches stderr.
+	shutdownFuncs = append(shutdownFuncs, func(context.Context) error {
+		slog.SetDefault(slog.New(newFallbackLogHandler()))
+		return nil
+	})
+	shutdownFuncs = append(shutdownFuncs, named("logger provider", lp.Shutdown))
+	global.SetLoggerProvider(lp)
+	slog.SetDefault(slog.New(newLogHandler(cfg.serviceName, lp, otlpLogs, consoleLogs)))
+
+	// Once logging is set up, so that the changes it makes are logged.
+	if err := rc.start(ctx); err != nil {
+		return fail(err)
+	}
+	shutdownFuncs = append(shutdownFuncs, named("config watcher", rc.shutdown))
+
+	if err := admin.start(); err != nil {
+		return fail(err)
+	}
+	shutdownFuncs = append(shutdownFuncs, named("admin server", admin.shutdown))
+
+	return shutdown, nil
+}
+
+// named wraps the error of a shutdown step with what it shuts down, so that
+// a flush timing out says which provider it was. A provider joins the errors
+// of its processors: each of them gets the name.
+func named(name string, shutdown func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		err := shutdown(ctx)
+		if err == nil {
+			return nil
+		}
+		joined, ok := err.(interface{ Unwrap() []error })
+		if !ok {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		var errs []error
+		for _, err := range joined.Unwrap() {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// newTracerProvider builds the TracerProvider, records its sampler and
+// exporters in status and serves its recent spans on the admin listener.
+func newTracerProvider(ctx context.Context, cfg *config, res *resource.Resource, status *pipelineStatus, admin *adminServer) (*sdktrace.TracerProvider, error) {
+	exporters, err := newTraceExporters(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sampler, err := initialSampler(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithRawSpanLimits(spanLimits(cfg)),
+		sdktrace.WithSpanProcessor(newLimitsProcessor()),
+	}
+
+	baggageOpts, err := baggageAttributeOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if baggageOpts != nil {
+		opts = append(opts, sdktrace.WithSpanProcessor(baggageattr.New(baggageOpts...)))
+	}
+
+	// Beside the exporters, so the pages keep working when they fail.
+	zp := zpages.New()
+	opts = append(opts, sdktrace.WithSpanProcessor(zp))
+	admin.Handle("GET /debug/tracez", zp.TracezHandler())
+	admin.Handle("GET /debug/rpcz", zp.RpczHandler())
+
+	var processors fanout
+	for _, exporter := range exporters {
+		processors = append(processors, countingProcessor{sdktrace.NewBatchSpanProcessor(exporter), exporter.counts})
+		status.exporters = append(status.exporters, exporter.counts)
+	}
+	status.sampler = sampler
+
+	tailOpts, tail, err := tailSamplingOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tail && len(processors) > 0 {
+		opts = append(opts, sdktrace.WithSpanProcessor(tailsampling.New(processors, tailOpts...)))
+	} else {
+		for _, p := range processors {
+			opts = append(opts, sdktrace.WithSpanProcessor(p))
+		}
+	}
+	return sdktrace.NewTracerProvider(append(opts, cfg.traceOpts...)...), nil
+}
+
+func newMeterProvider(ctx context.Context, cfg *config, res *resource.Resource, admin *adminServer, producers []sdkmetric.Producer) (*sdkmetric.MeterProvider, error) {
+	readers, err := newMetricReaders(ctx, admin, producers)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := cfg.exemplarFilter
+	if filter == nil {
+		if filter, err = exemplarFilterFromEnv(); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithExemplarFilter(filter),
+	}
+	for _, r := range readers {
+		opts = append(opts, sdkmetric.WithReader(r))
+	}
+	return sdkmetric.NewMeterProvider(append(opts, cfg.meterOpts...)...), nil
+}
+
+func newLoggerProvider(ctx context.Context, cfg *config, res *resource.Resource) (*sdklog.LoggerProvider, bool, bool, error) {
+	processors, console, err := newLogProcessors(ctx)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	opts := []sdklog.LoggerProviderOption{
+		sdklog.WithResource(res),
+	}
+	for _, p := range processors {
+		opts = append(opts, sdklog.WithProcessor(p))
+	}
+	opts = append(opts, cfg.loggerOpts...)
+	return sdklog.NewLoggerProvider(opts...), len(processors) > 0 || len(cfg.loggerOpts) > 0, console, nil
+}
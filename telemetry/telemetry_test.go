@@ -0,0 +1,96 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// metricSink keeps the last value exported of each span export metric,
+// keyed by metric name and outcome. The reader reuses what it exports, so
+// the values are copied out.
+type metricSink struct {
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+func (s *metricSink) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(k)
+}
+
+func (s *metricSink) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(k)
+}
+
+func (s *metricSink) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					outcome, _ := dp.Attributes.Value("outcome")
+					s.values[m.Name+"/"+outcome.AsString()] = dp.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					outcome, _ := dp.Attributes.Value("outcome")
+					s.values[m.Name+"/"+outcome.AsString()] = int64(dp.Count)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *metricSink) ForceFlush(context.Context) error { return nil }
+func (s *metricSink) Shutdown(context.Context) error   { return nil }
+
+func (s *metricSink) value(key string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+// TestShutdownExportsFlushMetrics ends a span that only the final flush
+// exports: the meter provider must still be up to record that export.
+func TestShutdownExportsFlushMetrics(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer collector.Close()
+	t.Setenv("OTEL_TRACES_EXPORTER", "otlp")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "http/json")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+	t.Setenv("OTEL_METRICS_EXPORTER", "none")
+	t.Setenv("OTEL_LOGS_EXPORTER", "none")
+	t.Setenv("OTEL_BSP_SCHEDULE_DELAY", "60000")
+
+	sink := &metricSink{values: map[string]int64{}}
+	shutdown, err := Setup(context.Background(),
+		WithServiceName("test"),
+		WithAdminAddr("localhost:0"),
+		WithRuntimeMetrics(false),
+		WithMeterProviderOptions(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(sink))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "op")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sink.value("otel.exporter.spans/exported"); got != 1 {
+		t.Errorf("otel.exporter.spans exported = %d, want 1", got)
+	}
+	if got := sink.value("otel.exporter.span.export.duration/exported"); got != 1 {
+		t.Errorf("otel.exporter.span.export.duration count = %d, want 1", got)
+	}
+}
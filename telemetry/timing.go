@@ -0,0 +1,224 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serverTimingTotal is the Server-Timing metric holding the duration of the
+// server span; the other metrics are downstream hops.
+const serverTimingTotal = "total"
+
+// Timing is one metric of a Server-Timing header: the time a request spent
+// in a service.
+type Timing struct {
+	Name     string
+	Duration time.Duration
+}
+
+// serverTiming collects the downstream hops of the request being served.
+type serverTiming struct {
+	mu   sync.Mutex
+	hops []Timing
+}
+
+type serverTimingKey struct{}
+
+func withServerTiming(ctx context.Context) (context.Context, *serverTiming) {
+	st := &serverTiming{}
+	return context.WithValue(ctx, serverTimingKey{}, st), st
+}
+
+// recordHop adds a call to service that took d to the request being served,
+// along with the hops that service reported in its own Server-Timing.
+func recordHop(ctx context.Context, service string, d time.Duration, serverTimings []string) {
+	st, _ := ctx.Value(serverTimingKey{}).(*serverTiming)
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.hops = append(st.hops, Timing{Name: service, Duration: d})
+	for _, t := range ParseServerTiming(serverTimings...) {
+		if t.Name != serverTimingTotal {
+			st.hops = append(st.hops, t)
+		}
+	}
+}
+
+// header formats the Server-Timing header of a request that took total.
+func (st *serverTiming) header(total time.Duration) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	metrics := make([]string, 0, len(st.hops)+1)
+	metrics = append(metrics, formatTiming(serverTimingTotal, total))
+	for _, h := range st.hops {
+		metrics = append(metrics, formatTiming(h.Name, h.Duration))
+	}
+	return strings.Join(metrics, ", ")
+}
+
+func formatTiming(name string, d time.Duration) string {
+	return name + ";dur=" + strconv.FormatFloat(float64(d.Microseconds())/1000, 'f', -1, 64)
+}
+
+// ParseServerTiming parses Server-Timing header values, skipping metrics
+// that are malformed or have no duration. Only the first dur parameter of a
+// metric counts, and quoted parameter values such as desc may hold commas
+// and semicolons.
+func ParseServerTiming(values ...string) []Timing {
+	var out []Timing
+	for _, v := range values {
+		for _, metric := range splitUnquoted(v, ',') {
+			params := splitUnquoted(metric, ';')
+			name := strings.TrimSpace(params[0])
+			if name == "" || strings.ContainsAny(name, "\" =\t") {
+				continue
+			}
+			for _, p := range params[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if !strings.EqualFold(strings.TrimSpace(k), "dur") {
+					continue
+				}
+				ms, err := strconv.ParseFloat(strings.Trim(strings.TrimSpace(v), `"`), 64)
+				if err == nil && !math.IsNaN(ms) && !math.IsInf(ms, 0) {
+					out = append(out, Timing{Name: name, Duration: time.Duration(ms * float64(time.Millisecond))})
+				}
+				break
+			}
+		}
+	}
+	return out
+}
+
+// splitUnquoted splits s at every sep outside double-quoted strings, in
+// which a backslash escapes the next character.
+func splitUnquoted(s string, sep byte) []string {
+	var (
+		parts  []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// traceResponse formats sc as a traceresponse header, as defined by the
+// W3C Trace Context Level 2 draft: the version, the trace ID, the ID of the
+// server span and the trace flags.
+func traceResponse(sc trace.SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
+
+// traceHeaders sets traceresponse, X-Trace-Id and Server-Timing on every
+// response, so that a client can find the trace of a failed call. The
+// headers are set when the response headers are written, so Server-Timing
+// covers the handler up to then.
+func traceHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, st := withServerTiming(r.Context())
+		tw := &timingWriter{ResponseWriter: w, ctx: ctx, start: time.Now(), timing: st}
+		next.ServeHTTP(tw, r.WithContext(ctx))
+		tw.setHeaders()
+	})
+}
+
+type timingWriter struct {
+	http.ResponseWriter
+	ctx    context.Context
+	start  time.Time
+	timing *serverTiming
+	done   bool
+}
+
+func (w *timingWriter) setHeaders() {
+	if w.done {
+		return
+	}
+	w.done = true
+	h := w.Header()
+	if sc := trace.SpanContextFromContext(w.ctx); sc.IsValid() {
+		h.Set("traceresponse", traceResponse(sc))
+		h.Set("X-Trace-Id", sc.TraceID().String())
+	}
+	h.Set("Server-Timing", w.timing.header(time.Since(w.start)))
+}
+
+func (w *timingWriter) WriteHeader(code int) {
+	w.setHeaders()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timingWriter) Write(b []byte) (int, error) {
+	w.setHeaders()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timingWriter) Flush() {
+	w.setHeaders()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *timingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// NewHTTPTransport wraps base with otelhttp, so that calls to service
+// produce client spans and carry the trace context, and adds each call, with
+// the hops service reports in its Server-Timing header, to the Server-Timing
+// of the request being served.
+func NewHTTPTransport(service string, base http.RoundTripper) http.RoundTripper {
+	return &hopTransport{service: service, next: otelhttp.NewTransport(base)}
+}
+
+type hopTransport struct {
+	service string
+	next    http.RoundTripper
+}
+
+func (t *hopTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	var timings []string
+	if res != nil {
+		timings = res.Header.Values("Server-Timing")
+	}
+	recordHop(req.Context(), t.service, time.Since(start), timings)
+	return res, err
+}
+
+// hopName names the service behind a gRPC target in Server-Timing:
+// "service-b" for discovery:///service-b or service-b:50051.
+func hopName(target string) string {
+	if u, err := url.Parse(target); err == nil && u.Scheme != "" && u.Opaque == "" {
+		target = strings.TrimPrefix(u.Path, "/")
+	}
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		return host
+	}
+	return target
+}
@@ -0,0 +1,199 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestParseServerTiming(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []Timing
+	}{
+		{"single", []string{"total;dur=12.5"}, []Timing{{"total", 12500 * time.Microsecond}}},
+		{"several", []string{"total;dur=3, service-b;dur=2", "service-c;dur=1"}, []Timing{
+			{"total", 3 * time.Millisecond}, {"service-b", 2 * time.Millisecond}, {"service-c", time.Millisecond},
+		}},
+		{"quoted desc", []string{`db;desc="a, b; c";dur=3, cache;dur=1`}, []Timing{
+			{"db", 3 * time.Millisecond}, {"cache", time.Millisecond},
+		}},
+		{"escaped quote", []string{`db;desc="say \"hi\", then go";dur=2`}, []Timing{{"db", 2 * time.Millisecond}}},
+		{"quoted dur", []string{`db;dur="4"`}, []Timing{{"db", 4 * time.Millisecond}}},
+		{"case and spaces", []string{" db ; DUR = 4 "}, []Timing{{"db", 4 * time.Millisecond}}},
+		{"first dur wins", []string{"db;dur=1;dur=2"}, []Timing{{"db", time.Millisecond}}},
+		{"missing dur", []string{"miss, db;desc=x, total;dur=1"}, []Timing{{"total", time.Millisecond}}},
+		{"malformed dur", []string{"a;dur=abc, b;dur=, c;dur=NaN, d;dur=1"}, []Timing{{"d", time.Millisecond}}},
+		{"malformed name", []string{";dur=1, a b;dur=2, \"c\";dur=3, d;dur=4"}, []Timing{{"d", 4 * time.Millisecond}}},
+		{"empty", []string{"", " , "}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseServerTiming(tt.values...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseServerTiming(%q) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+// recordSpans installs a tracer provider recording every span and the W3C
+// propagator for the duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+	return rec
+}
+
+// endedSpan waits for the span called name to end: a server span ends
+// after the response has been sent.
+func endedSpan(t *testing.T, rec *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	var span sdktrace.ReadOnlySpan
+	waitUntil(time.Second, func() bool {
+		for _, s := range rec.Ended() {
+			if s.Name() == name {
+				span = s
+			}
+		}
+		return span != nil
+	})
+	if span == nil {
+		t.Fatalf("no %s span recorded", name)
+	}
+	return span
+}
+
+func timingNames(timings []Timing) []string {
+	var names []string
+	for _, t := range timings {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func TestHTTPTraceHeaders(t *testing.T) {
+	rec := recordSpans(t)
+
+	// front calls service-y, which calls service-z.
+	back := httptest.NewServer(NewHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), "back"))
+	defer back.Close()
+	mid := httptest.NewServer(NewHTTPHandler(proxyTo(back.URL, "service-z", http.StatusOK), "mid"))
+	defer mid.Close()
+	front := httptest.NewServer(NewHTTPHandler(proxyTo(mid.URL, "service-y", http.StatusInternalServerError), "front"))
+	defer front.Close()
+
+	res, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	sc := endedSpan(t, rec, "front").SpanContext()
+	if got, want := res.Header.Get("X-Trace-Id"), sc.TraceID().String(); got != want {
+		t.Errorf("X-Trace-Id = %q, want %q", got, want)
+	}
+	if got, want := res.Header.Get("traceresponse"), fmt.Sprintf("00-%s-%s-01", sc.TraceID(), sc.SpanID()); got != want {
+		t.Errorf("traceresponse = %q, want %q", got, want)
+	}
+	// The hop to service-y and the one it reported, but not its total.
+	timings := ParseServerTiming(res.Header.Values("Server-Timing")...)
+	if got, want := timingNames(timings), []string{"total", "service-y", "service-z"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Server-Timing metrics = %v, want %v", got, want)
+	}
+}
+
+// proxyTo calls url through NewHTTPTransport and answers with code.
+func proxyTo(url, service string, code int) http.Handler {
+	client := &http.Client{Transport: NewHTTPTransport(service, http.DefaultTransport)}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+		if res, err := client.Do(req); err == nil {
+			res.Body.Close()
+		}
+		w.WriteHeader(code)
+	})
+}
+
+type testService struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (testService) EmptyCall(ctx context.Context, _ *testpb.Empty) (*testpb.Empty, error) {
+	return &testpb.Empty{}, nil
+}
+
+func TestGRPCTraceTrailers(t *testing.T) {
+	rec := recordSpans(t)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := NewGRPCServer()
+	testpb.RegisterTestServiceServer(srv, testService{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := NewGRPCClient("passthrough:///service-t", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, st := withServerTiming(context.Background())
+	var md metadata.MD
+	if _, err := testpb.NewTestServiceClient(conn).EmptyCall(ctx, &testpb.Empty{}, grpc.Trailer(&md)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server span may end after the client got the trailers.
+	var sc trace.SpanContext
+	waitUntil(time.Second, func() bool {
+		for _, s := range rec.Ended() {
+			if s.SpanKind() == trace.SpanKindServer {
+				sc = s.SpanContext()
+			}
+		}
+		return sc.IsValid()
+	})
+	if !sc.IsValid() {
+		t.Fatal("no server span recorded")
+	}
+	if got, want := md.Get("x-trace-id"), []string{sc.TraceID().String()}; !reflect.DeepEqual(got, want) {
+		t.Errorf("x-trace-id = %q, want %q", got, want)
+	}
+	if got, want := md.Get("traceresponse"), []string{fmt.Sprintf("00-%s-%s-01", sc.TraceID(), sc.SpanID())}; !reflect.DeepEqual(got, want) {
+		t.Errorf("traceresponse = %q, want %q", got, want)
+	}
+	if got := timingNames(ParseServerTiming(md.Get("server-timing")...)); !reflect.DeepEqual(got, []string{"total"}) {
+		t.Errorf("server-timing metrics = %v, want [total]", got)
+	}
+	// The client side records the call as a hop of the request it serves.
+	if got := timingNames(ParseServerTiming(st.header(0))); !reflect.DeepEqual(got, []string{"total", "service-t"}) {
+		t.Errorf("recorded hops = %v, want [total service-t]", got)
+	}
+}
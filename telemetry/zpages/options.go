@@ -0,0 +1,41 @@
+package zpages
+
+type config struct {
+	sampleSize int
+	maxNames   int
+	maxRunning int
+}
+
+// Option configures a Processor.
+type Option func(*config)
+
+// WithSampleSize sets how many recent spans are kept for each span name in
+// every latency bucket and in the error list. It defaults to 10.
+func WithSampleSize(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.sampleSize = n
+		}
+	}
+}
+
+// WithMaxNames bounds the number of distinct span names, and of RPC
+// methods, that are tracked. Spans with further names are only counted as
+// running. It defaults to 256.
+func WithMaxNames(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.maxNames = n
+		}
+	}
+}
+
+// WithMaxRunning bounds the number of running spans that are tracked. It
+// defaults to 1000.
+func WithMaxRunning(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.maxRunning = n
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package zpages
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracezHandler serves a summary of the span names with their running,
+// per latency bucket and error counts. Each count links to the spans kept
+// for it: ?name=<span name>&type=running|latency|error[&bucket=<index>].
+func (p *Processor) TracezHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		q := r.URL.Query()
+		if name := q.Get("name"); name != "" {
+			bucket, _ := strconv.Atoi(q.Get("bucket"))
+			render(w, "spans", p.spans(name, q.Get("type"), bucket))
+			return
+		}
+		render(w, "tracez", p.summary())
+	})
+}
+
+// RpczHandler serves per-method statistics of the RPCs sent and received.
+func (p *Processor) RpczHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		render(w, "rpcz", p.rpcRows())
+	})
+}
+
+type summaryRow struct {
+	Name    string
+	Running int
+	Latency []int64
+	Errors  int64
+}
+
+type summaryPage struct {
+	Buckets []string
+	Rows    []summaryRow
+}
+
+func (p *Processor) summary() summaryPage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rows := make(map[string]*summaryRow)
+	row := func(name string) *summaryRow {
+		if r, ok := rows[name]; ok {
+			return r
+		}
+		r := &summaryRow{Name: name, Latency: make([]int64, len(latencyBounds))}
+		rows[name] = r
+		return r
+	}
+	for _, s := range p.running {
+		row(s.Name()).Running++
+	}
+	for name, ns := range p.names {
+		r := row(name)
+		for i := range ns.latency {
+			r.Latency[i] = ns.latency[i].total
+		}
+		r.Errors = ns.errors.total
+	}
+
+	page := summaryPage{Buckets: bucketLabels()}
+	for _, r := range rows {
+		page.Rows = append(page.Rows, *r)
+	}
+	sort.Slice(page.Rows, func(i, j int) bool { return page.Rows[i].Name < page.Rows[j].Name })
+	return page
+}
+
+func bucketLabels() []string {
+	labels := make([]string, len(latencyBounds))
+	for i, b := range latencyBounds {
+		labels[i] = ">=" + b.String()
+	}
+	return labels
+}
+
+type spanRow struct {
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Kind     string
+	Start    string
+	Duration string
+	Status   string
+	Attrs    []string
+	Events   []string
+}
+
+type spansPage struct {
+	Name  string
+	Title string
+	Spans []spanRow
+}
+
+func (p *Processor) spans(name, kind string, bucket int) spansPage {
+	page := spansPage{Name: name}
+	var spans []sdktrace.ReadOnlySpan
+
+	p.mu.Lock()
+	switch kind {
+	case "running":
+		page.Title = "running"
+		for _, s := range p.running {
+			if s.Name() == name {
+				spans = append(spans, s)
+			}
+		}
+		sort.Slice(spans, func(i, j int) bool { return spans[i].StartTime().Before(spans[j].StartTime()) })
+	case "error":
+		page.Title = "errors"
+		if ns, ok := p.names[name]; ok {
+			spans = ns.errors.recent()
+		}
+	default:
+		if bucket < 0 || bucket >= len(latencyBounds) {
+			bucket = 0
+		}
+		page.Title = "latency " + bucketLabels()[bucket]
+		if ns, ok := p.names[name]; ok {
+			spans = ns.latency[bucket].recent()
+		}
+	}
+	p.mu.Unlock()
+
+	// Running spans are still being written to; their accessors lock, so
+	// they are read outside of p.mu.
+	now := time.Now()
+	for _, s := range spans {
+		page.Spans = append(page.Spans, newSpanRow(s, now))
+	}
+	return page
+}
+
+func newSpanRow(s sdktrace.ReadOnlySpan, now time.Time) spanRow {
+	end := s.EndTime()
+	if end.IsZero() {
+		end = now
+	}
+	row := spanRow{
+		TraceID:  s.SpanContext().TraceID().String(),
+		SpanID:   s.SpanContext().SpanID().String(),
+		Kind:     s.SpanKind().String(),
+		Start:    s.StartTime().Format("2006-01-02 15:04:05.000000"),
+		Duration: end.Sub(s.StartTime()).String(),
+		Status:   s.Status().Code.String(),
+	}
+	if s.Parent().IsValid() {
+		row.ParentID = s.Parent().SpanID().String()
+	}
+	if desc := s.Status().Description; desc != "" {
+		row.Status += ": " + desc
+	}
+	for _, kv := range s.Attributes() {
+		row.Attrs = append(row.Attrs, string(kv.Key)+"="+kv.Value.Emit())
+	}
+	for _, e := range s.Events() {
+		row.Events = append(row.Events, "+"+e.Time.Sub(s.StartTime()).String()+" "+e.Name)
+	}
+	return row
+}
+
+type rpcRow struct {
+	Method     string
+	Kind       string
+	Count      int64
+	LastMinute int64
+	Errors     int64
+	Mean       string
+	Max        string
+}
+
+func (p *Processor) rpcRows() []rpcRow {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	rows := make([]rpcRow, 0, len(p.rpcs))
+	for key, rs := range p.rpcs {
+		kind := "received"
+		if key.kind == trace.SpanKindClient {
+			kind = "sent"
+		}
+		rows = append(rows, rpcRow{
+			Method:     key.method,
+			Kind:       kind,
+			Count:      rs.count,
+			LastMinute: rs.lastMinute(now),
+			Errors:     rs.errors,
+			Mean:       (rs.total / time.Duration(rs.count)).String(),
+			Max:        rs.max.String(),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Kind != rows[j].Kind {
+			return rows[i].Kind < rows[j].Kind
+		}
+		return rows[i].Method < rows[j].Method
+	})
+	return rows
+}
+
+func render(w http.ResponseWriter, name string, data any) {
+	if err := pages.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var pages = template.Must(template.New("").Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.}}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: right; vertical-align: top; }
+td.l, th.l { text-align: left; }
+</style></head><body>{{end}}
+
+{{define "tracez"}}{{template "head" "tracez"}}
+<h1>tracez</h1>
+<p>Spans ended since start, by latency bucket; the last few of each are kept. <a href="?">refresh</a></p>
+<table>
+<tr><th class="l">Span name</th><th>Running</th>{{range .Buckets}}<th>{{.}}</th>{{end}}<th>Errors</th></tr>
+{{range .Rows}}{{$name := .Name}}<tr>
+<td class="l">{{.Name}}</td>
+<td>{{if .Running}}<a href="?name={{.Name}}&type=running">{{.Running}}</a>{{else}}0{{end}}</td>
+{{range $i, $n := .Latency}}<td>{{if $n}}<a href="?name={{$name}}&type=latency&bucket={{$i}}">{{$n}}</a>{{else}}0{{end}}</td>{{end}}
+<td>{{if .Errors}}<a href="?name={{.Name}}&type=error">{{.Errors}}</a>{{else}}0{{end}}</td>
+</tr>{{end}}
+</table>
+</body></html>{{end}}
+
+{{define "spans"}}{{template "head" "tracez"}}
+<h1>{{.Name}}: {{.Title}}</h1>
+<p><a href="?">back</a></p>
+<table>
+<tr><th class="l">Start</th><th>Duration</th><th class="l">Trace ID</th><th class="l">Span ID</th><th class="l">Parent</th><th class="l">Kind</th><th class="l">Status</th><th class="l">Attributes</th><th class="l">Events</th></tr>
+{{range .Spans}}<tr>
+<td class="l">{{.Start}}</td><td>{{.Duration}}</td>
+<td class="l">{{.TraceID}}</td><td class="l">{{.SpanID}}</td><td class="l">{{.ParentID}}</td>
+<td class="l">{{.Kind}}</td><td class="l">{{.Status}}</td>
+<td class="l">{{range .Attrs}}{{.}}<br>{{end}}</td>
+<td class="l">{{range .Events}}{{.}}<br>{{end}}</td>
+</tr>{{else}}<tr><td class="l" colspan="9">No spans kept.</td></tr>{{end}}
+</table>
+</body></html>{{end}}
+
+{{define "rpcz"}}{{template "head" "rpcz"}}
+<h1>rpcz</h1>
+<table>
+<tr><th class="l">Method</th><th class="l">Direction</th><th>Count</th><th>Last minute</th><th>Errors</th><th>Mean latency</th><th>Max latency</th></tr>
+{{range .}}<tr>
+<td class="l">{{.Method}}</td><td class="l">{{.Kind}}</td><td>{{.Count}}</td><td>{{.LastMinute}}</td>
+<td>{{.Errors}}</td><td>{{.Mean}}</td><td>{{.Max}}</td>
+</tr>{{else}}<tr><td class="l" colspan="7">No RPCs recorded.</td></tr>{{end}}
+</table>
+</body></html>{{end}}
+`))
@@ -0,0 +1,219 @@
+// Package zpages provides a span processor that keeps recent spans in
+// memory and serves them as the /debug/tracez and /debug/rpcz pages, so a
+// service can be inspected without a tracing backend.
+package zpages
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultSampleSize = 10
+	defaultMaxNames   = 256
+	defaultMaxRunning = 1000
+)
+
+// latencyBounds are the lower bounds of the latency buckets, as on the
+// OpenCensus zPages.
+var latencyBounds = []time.Duration{
+	0,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	100 * time.Second,
+}
+
+// Processor records every span ended in the process, whatever happens to it
+// downstream: it sits beside the exporters, so the pages keep working when
+// the collector is unreachable. Memory is bounded by the sample size, the
+// number of span names and the number of running spans.
+type Processor struct {
+	sampleSize int
+	maxNames   int
+	maxRunning int
+
+	mu      sync.Mutex
+	running map[trace.SpanID]sdktrace.ReadWriteSpan
+	names   map[string]*nameStats
+	rpcs    map[rpcKey]*rpcStats
+}
+
+var _ sdktrace.SpanProcessor = (*Processor)(nil)
+
+// New returns a Processor.
+func New(opts ...Option) *Processor {
+	cfg := config{
+		sampleSize: defaultSampleSize,
+		maxNames:   defaultMaxNames,
+		maxRunning: defaultMaxRunning,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Processor{
+		sampleSize: cfg.sampleSize,
+		maxNames:   cfg.maxNames,
+		maxRunning: cfg.maxRunning,
+		running:    make(map[trace.SpanID]sdktrace.ReadWriteSpan),
+		names:      make(map[string]*nameStats),
+		rpcs:       make(map[rpcKey]*rpcStats),
+	}
+}
+
+// nameStats holds the recent spans of one name.
+type nameStats struct {
+	latency []ring
+	errors  ring
+}
+
+// ring keeps the last spans added to it and counts all of them.
+type ring struct {
+	spans []sdktrace.ReadOnlySpan
+	next  int
+	total int64
+}
+
+func (r *ring) add(s sdktrace.ReadOnlySpan, size int) {
+	r.total++
+	if len(r.spans) < size {
+		r.spans = append(r.spans, s)
+		return
+	}
+	r.spans[r.next] = s
+	r.next = (r.next + 1) % size
+}
+
+// recent returns the kept spans, newest first.
+func (r *ring) recent() []sdktrace.ReadOnlySpan {
+	out := make([]sdktrace.ReadOnlySpan, 0, len(r.spans))
+	for i := len(r.spans) - 1; i >= 0; i-- {
+		out = append(out, r.spans[(r.next+i)%len(r.spans)])
+	}
+	return out
+}
+
+func latencyBucket(d time.Duration) int {
+	i := sort.Search(len(latencyBounds), func(i int) bool { return latencyBounds[i] > d })
+	return max(i-1, 0)
+}
+
+// OnStart tracks s as running.
+func (p *Processor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.running) < p.maxRunning {
+		p.running[s.SpanContext().SpanID()] = s
+	}
+}
+
+// OnEnd files s under its name, latency bucket and, for RPCs, method.
+func (p *Processor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.running, s.SpanContext().SpanID())
+
+	ns, ok := p.names[s.Name()]
+	if !ok {
+		if len(p.names) >= p.maxNames {
+			return
+		}
+		ns = &nameStats{latency: make([]ring, len(latencyBounds))}
+		p.names[s.Name()] = ns
+	}
+	if s.Status().Code == codes.Error {
+		ns.errors.add(s, p.sampleSize)
+	} else {
+		ns.latency[latencyBucket(s.EndTime().Sub(s.StartTime()))].add(s, p.sampleSize)
+	}
+	p.recordRPC(s)
+}
+
+func (p *Processor) recordRPC(s sdktrace.ReadOnlySpan) {
+	var system, service, method string
+	for _, kv := range s.Attributes() {
+		switch kv.Key {
+		case semconv.RPCSystemKey:
+			system = kv.Value.AsString()
+		case semconv.RPCServiceKey:
+			service = kv.Value.AsString()
+		case semconv.RPCMethodKey:
+			method = kv.Value.AsString()
+		}
+	}
+	if system == "" || method == "" {
+		return
+	}
+	key := rpcKey{kind: s.SpanKind(), method: service + "/" + method}
+	rs, ok := p.rpcs[key]
+	if !ok {
+		if len(p.rpcs) >= p.maxNames {
+			return
+		}
+		rs = &rpcStats{}
+		p.rpcs[key] = rs
+	}
+	rs.add(s.EndTime(), s.EndTime().Sub(s.StartTime()), s.Status().Code == codes.Error)
+}
+
+// ForceFlush does nothing.
+func (p *Processor) ForceFlush(context.Context) error { return nil }
+
+// Shutdown does nothing; the pages keep showing what was recorded.
+func (p *Processor) Shutdown(context.Context) error { return nil }
+
+type rpcKey struct {
+	kind   trace.SpanKind
+	method string
+}
+
+// rpcStats aggregates the calls of one RPC method, keeping per-second
+// counts of the last minute for rates.
+type rpcStats struct {
+	count, errors int64
+	total, max    time.Duration
+	seconds       [60]secondCount
+}
+
+type secondCount struct {
+	unix  int64
+	count int64
+}
+
+func (r *rpcStats) add(end time.Time, d time.Duration, failed bool) {
+	r.count++
+	if failed {
+		r.errors++
+	}
+	r.total += d
+	r.max = max(r.max, d)
+
+	sec := end.Unix()
+	slot := &r.seconds[sec%int64(len(r.seconds))]
+	if slot.unix != sec {
+		*slot = secondCount{unix: sec}
+	}
+	slot.count++
+}
+
+// lastMinute returns the calls that ended within the minute before now.
+func (r *rpcStats) lastMinute(now time.Time) int64 {
+	var n int64
+	for _, s := range r.seconds {
+		if now.Unix()-s.unix < int64(len(r.seconds)) {
+			n += s.count
+		}
+	}
+	return n
+}
@@ -0,0 +1,115 @@
+package zpages
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// endSpan records a span that took d through tp, failed if failed is set.
+func endSpan(tp trace.TracerProvider, name string, d time.Duration, failed bool, opts ...trace.SpanStartOption) {
+	start := time.Now().Add(-d)
+	_, span := tp.Tracer("test").Start(context.Background(), name, append(opts, trace.WithTimestamp(start))...)
+	if failed {
+		span.SetStatus(codes.Error, "failed")
+	}
+	span.End(trace.WithTimestamp(start.Add(d)))
+}
+
+func TestTracez(t *testing.T) {
+	p := New(WithSampleSize(2))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(p))
+
+	endSpan(tp, "op", 5*time.Microsecond, false)
+	for range 3 {
+		endSpan(tp, "op", 2*time.Millisecond, false)
+	}
+	endSpan(tp, "op", 20*time.Second, false)
+	endSpan(tp, "op", time.Millisecond, true)
+	endSpan(tp, "op", 2*time.Millisecond, true)
+	endSpan(tp, "other", 0, false)
+	_, running := tp.Tracer("test").Start(context.Background(), "op")
+	defer running.End()
+
+	page := p.summary()
+	if len(page.Rows) != 2 || page.Rows[0].Name != "op" || page.Rows[1].Name != "other" {
+		t.Fatalf("summary rows = %+v, want op and other", page.Rows)
+	}
+	op := page.Rows[0]
+	// Buckets: >=0, >=10µs, >=100µs, >=1ms, >=10ms, >=100ms, >=1s, >=10s,
+	// >=1m40s. Errors are counted apart, whatever their latency.
+	if want := []int64{1, 0, 0, 3, 0, 0, 0, 1, 0}; !reflect.DeepEqual(op.Latency, want) {
+		t.Errorf("op latency counts = %v, want %v", op.Latency, want)
+	}
+	if op.Errors != 2 || op.Running != 1 {
+		t.Errorf("op errors, running = %d, %d, want 2, 1", op.Errors, op.Running)
+	}
+
+	// All spans are counted, but only the sample size of them kept.
+	if spans := p.spans("op", "latency", 3).Spans; len(spans) != 2 {
+		t.Errorf("%d spans kept in the >=1ms bucket, want 2", len(spans))
+	}
+	errs := p.spans("op", "error", 0).Spans
+	if len(errs) != 2 || errs[0].Duration != "2ms" || errs[1].Duration != "1ms" {
+		t.Errorf("error spans = %+v, want the 2ms then the 1ms one", errs)
+	}
+	if spans := p.spans("op", "running", 0).Spans; len(spans) != 1 {
+		t.Errorf("%d running spans listed, want 1", len(spans))
+	}
+
+	w := httptest.NewRecorder()
+	p.TracezHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/tracez", nil))
+	if body := w.Body.String(); w.Code != 200 || !strings.Contains(body, `?name=op&type=error">2</a>`) {
+		t.Errorf("GET /debug/tracez = %d\n%s", w.Code, body)
+	}
+}
+
+func TestRpcz(t *testing.T) {
+	p := New()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(p))
+
+	rpc := func(method string) trace.SpanStartOption {
+		return trace.WithAttributes(
+			semconv.RPCSystemGRPC,
+			semconv.RPCService("service.ServiceB"),
+			semconv.RPCMethod(method),
+		)
+	}
+	server, client := trace.WithSpanKind(trace.SpanKindServer), trace.WithSpanKind(trace.SpanKindClient)
+	endSpan(tp, "service.ServiceB/DoSomething", time.Millisecond, false, server, rpc("DoSomething"))
+	endSpan(tp, "service.ServiceB/DoSomething", 3*time.Millisecond, false, server, rpc("DoSomething"))
+	endSpan(tp, "service.ServiceB/DoSomething", 5*time.Millisecond, true, server, rpc("DoSomething"))
+	endSpan(tp, "service.ServiceB/DoSomething", 2*time.Millisecond, false, client, rpc("DoSomething"))
+	endSpan(tp, "service.ServiceB/Other", 4*time.Millisecond, true, server, rpc("Other"))
+	// Not an RPC.
+	endSpan(tp, "GET /start", time.Millisecond, false, server, trace.WithAttributes(attribute.String("http.route", "/start")))
+
+	want := []rpcRow{
+		{Method: "service.ServiceB/DoSomething", Kind: "received", Count: 3, LastMinute: 3, Errors: 1, Mean: "3ms", Max: "5ms"},
+		{Method: "service.ServiceB/Other", Kind: "received", Count: 1, LastMinute: 1, Errors: 1, Mean: "4ms", Max: "4ms"},
+		{Method: "service.ServiceB/DoSomething", Kind: "sent", Count: 1, LastMinute: 1, Errors: 0, Mean: "2ms", Max: "2ms"},
+	}
+	if got := p.rpcRows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rpcRows() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestLastMinute(t *testing.T) {
+	var r rpcStats
+	now := time.Now()
+	r.add(now.Add(-2*time.Minute), time.Millisecond, false)
+	r.add(now.Add(-30*time.Second), time.Millisecond, false)
+	r.add(now, time.Millisecond, false)
+	if got := r.lastMinute(now); got != 2 {
+		t.Errorf("lastMinute() = %d, want 2", got)
+	}
+}